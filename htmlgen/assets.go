@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/images"
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// Stylesheets, scripts and the favicon are written with a hash of their
+// contents in their names (e.g. /style.1a2b3c4d5e.css), so browsers don't keep
+// old ones after a deploy. Pages link to them with the asset template function
+// (see site/assets.go). Anything else can look them up in the asset manifest,
+// which also has the fingerprinted name of each image (see imagegen.go).
+
+const assetManifestFile = "asset-manifest.json"
+
+type assetFile struct {
+	path    string // Where it would be without a hash, e.g. /style.css
+	content []byte
+}
+
+// Records the fingerprinted name of each asset in assets.
+func assetJobs(b *build, assets map[string]string) ([]jobFn, error) {
+	var files []assetFile
+
+	// -> Stylesheets
+	style, err := os.ReadFile(filepath.Join(staticMinableFolder, "style.css"))
+	if err != nil {
+		log.Err(err).Msg("could not read stylesheet")
+		return nil, err
+	}
+	files = append(files, assetFile{"/style.css", style})
+	for _, s := range []struct{ path, name, lightDark string }{
+		{"/dark.css", "monokai", "dark"},
+		{"/light.css", "tango", "light"},
+	} {
+		var buf bytes.Buffer
+		err := writeStyle(s.name, s.lightDark)(&buf)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, assetFile{s.path, buf.Bytes()})
+	}
+
+	// -> Poster placeholders, for the reviews page
+	placeholders, err := site.PlaceholdersCSS()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, assetFile{site.PlaceholdersStylesheet, placeholders})
+
+	// -> Script, with the maybe pages for the 404 page
+	script, err := bundleScript(maybePages())
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, assetFile{"/script.js", script})
+
+	// -> Favicon
+	favicon, err := os.ReadFile(images.Loc("/images/favicon.ico"))
+	if err != nil {
+		log.Err(err).Msg("could not read favicon")
+		return nil, err
+	}
+	files = append(files, assetFile{"/images/favicon.ico", favicon})
+
+	var jobs []jobFn
+	for _, f := range files {
+		name := fingerprinted(f.path, f.content)
+		assets[f.path] = name
+		jobs = append(jobs, b.fileJob(strings.TrimPrefix(name, "/"), hashBytes(f.content), writeBytes(f.content)))
+	}
+	return jobs, nil
+}
+
+// E.g. /style.css -> /style.1a2b3c4d5e.css
+func fingerprinted(p string, content []byte) string {
+	ext := path.Ext(p)
+	hash := hashBytes(content)[:images.FingerprintLength]
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(p, ext), hash, ext)
+}
+
+func bundleScript(maybes []maybePage) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeMaybePages(maybes)(&buf)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	script, err := os.ReadFile(filepath.Join(staticMinableFolder, "script.js"))
+	if err != nil {
+		log.Err(err).Msg("could not read script")
+		return nil, err
+	}
+	buf.Write(script)
+	return buf.Bytes(), nil
+}
+
+func writeBytes(content []byte) withFile {
+	return func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	}
+}
+
+func writeAssetManifest(assets map[string]string) withFile {
+	return func(w io.Writer) error {
+		raw, err := json.MarshalIndent(assets, "", "  ")
+		if err != nil {
+			log.Err(err).Msg("could not marshal asset manifest")
+			return err
+		}
+		_, err = w.Write(raw)
+		if err != nil {
+			log.Err(err).Msg("could not write asset manifest")
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	"github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+	"github.com/tdewolff/minify/v2/xml"
+)
+
+// Build makes the deployable site: it generates the site, then puts it
+// together with the static folder, minifying and precompressing what it can,
+// and securing pages (see csp.go). Static files win where both have the same
+// file.
+//
+//	htmlgen build [-gen _site_gen] [-output _site] [-host github]
+func Build(args []string) error {
+	start := time.Now()
+
+	// Parse flags
+	fs := flag.NewFlagSet("htmlgen build", flag.ContinueOnError)
+	cfg := genConfigFlags(fs)
+	fs.StringVar(&cfg.OutputFolder, "gen", "_site_gen", "folder to generate the site into, kept between builds")
+	outputFlag := fs.String("output", "_site", "folder to put the deployable site in")
+	hostFlag := fs.String("host", "github", "host to write redirects and headers for, one of "+strings.Join(hostNames(), ", ")+
+		" (github gets none, and s3 can only match redirects by the start of a missing key)")
+	if err := fs.Parse(args); err != nil {
+		log.Err(err).Msg("arg parse fail")
+		return err
+	}
+	if _, err := hostFormatOf(*hostFlag); err != nil {
+		return err
+	}
+
+	// Generate the site
+	err := GenSite(*cfg)
+	if err != nil {
+		return err
+	}
+
+	// Put it together
+	err = publishSite(cfg.OutputFolder, *outputFlag, *hostFlag)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("output_folder", *outputFlag).
+		Msgf("site built in %v", time.Since(start))
+	return nil
+}
+
+// Mirrors genFolder into outputFolder minified, and static over the top, with
+// config for host (see hosting.go). Like generating, this is done in a staging
+// folder, so a failure leaves the last site as is.
+func publishSite(genFolder, outputFolder string, host string) error {
+	staging, err := stageOutput(outputFolder, true)
+	if err != nil {
+		return err
+	}
+
+	// -> Generated files
+	var minified, original int64
+	err = filepath.WalkDir(genFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(genFolder, p)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(staging, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(to, os.ModePerm)
+		case rel == manifestFile || !d.Type().IsRegular():
+			return nil
+		}
+
+		mediaType, ok := minifiable[filepath.Ext(p)]
+		if !ok {
+			return linkOrCopy(p, to)
+		}
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = minifier.Minify(mediaType, &buf, bytes.NewReader(raw))
+		if err != nil {
+			log.Err(err).Str("file", p).Msg("could not minify")
+			return err
+		}
+		original += int64(len(raw))
+		minified += int64(buf.Len())
+		return os.WriteFile(to, buf.Bytes(), 0664)
+	})
+	if err != nil {
+		log.Err(err).Str("gen_folder", genFolder).Msg("could not copy generated site")
+		return err
+	}
+
+	// -> Static files, as they are
+	err = filepath.WalkDir(staticFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(staticFolder, p)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(staging, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(to, os.ModePerm)
+		case !d.Type().IsRegular():
+			return nil
+		}
+		err = os.Remove(to)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return linkOrCopy(p, to)
+	})
+	if err != nil {
+		log.Err(err).Str("static_folder", staticFolder).Msg("could not copy static files")
+		return err
+	}
+
+	log.Debug().
+		Int64("original", original).
+		Int64("minified", minified).
+		Msg("minified site")
+
+	// -> Integrity and a content security policy, for what pages load
+	policy, err := secureSite(staging)
+	if err != nil {
+		return err
+	}
+
+	// -> Redirects and headers, for hosts which can do them properly
+	besideSite, err := writeHostConfig(host, staging, policy)
+	if err != nil {
+		return err
+	}
+
+	// -> For hosts which serve precompressed files
+	err = precompress(staging)
+	if err != nil {
+		return err
+	}
+
+	err = swapOutput(staging, outputFolder)
+	if err != nil {
+		return err
+	}
+	return writeBesideSite(outputFolder, besideSite)
+}
+
+// Media types of the files worth minifying, by extension.
+var minifiable = map[string]string{
+	".html": "text/html",
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".svg":  "image/svg+xml",
+}
+
+// Set up like the minify command, so scripts and such in pages are minified
+// too.
+var minifier = func() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("text/html", html.Minify)
+	m.AddFunc("image/svg+xml", svg.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]json$`), json.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]xml$`), xml.Minify)
+	return m
+}()
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/linkrot"
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// Check generates the site and makes sure that everything it links to on the
+// site is there: pages, images, scripts, stylesheets and anchors. Links are
+// resolved against the output and static folders, like serve does.
+//
+// Links to other sites can be checked too, with -external. Those are only
+// reported on, since other sites going down shouldn't stop us.
+
+func Check(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("htmlgen check", flag.ContinueOnError)
+	cfg := genConfigFlags(fs)
+	externalFlag := fs.Bool("external", false, "also check links to other sites (slow, needs internet)")
+	externalTTLFlag := fs.Duration("external-ttl", 7*24*time.Hour, "how long to trust a cached external link check")
+	if err := fs.Parse(args); err != nil {
+		log.Err(err).Msg("arg parse fail")
+		return err
+	}
+
+	// Build somewhere temporary
+	tmp, err := os.MkdirTemp("", "htmlgen-check-")
+	if err != nil {
+		log.Err(err).Msg("could not make temp folder to build into")
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	cfg.OutputFolder = filepath.Join(tmp, "site")
+	err = GenSite(*cfg)
+	if err != nil {
+		return err
+	}
+
+	// Check it
+	broken, external, err := checkSite(cfg.OutputFolder)
+	if err != nil {
+		return err
+	}
+	if *externalFlag {
+		checker := linkrot.NewChecker()
+		checker.TTL = *externalTTLFlag
+		reportExternal(checker.Check(context.Background(), external.urls()), external)
+	}
+	for _, b := range broken {
+		log.Warn().
+			Str("page", b.Page).
+			Str("kind", b.Kind).
+			Str("ref", b.Ref).
+			Msg(b.Reason)
+	}
+	if len(broken) > 0 {
+		err = fmt.Errorf("found %d broken links", len(broken))
+		log.Err(err).Msg("site check failed")
+		return err
+	}
+
+	log.Info().Msg("site check passed, no broken links")
+	return nil
+}
+
+type brokenRef struct {
+	Page   string // Short of the page the ref is on.
+	Kind   string
+	Ref    string
+	Reason string
+}
+
+// A link to something, found on a page.
+type pageRef struct {
+	Kind string // e.g. link, image
+	Ref  string
+}
+
+type checkedPage struct {
+	refs []pageRef
+	ids  map[string]bool
+}
+
+type siteChecker struct {
+	roots    []string
+	pages    map[string]*checkedPage // Keyed by file location
+	external externalRefs
+}
+
+// Links to other sites, and the shorts of the pages they're on.
+type externalRefs map[string][]string
+
+func (refs externalRefs) urls() []string {
+	var urls []string
+	for u := range refs {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Checks every generated HTML page in outputFolder, and gathers the links to
+// other sites on them.
+func checkSite(outputFolder string) ([]brokenRef, externalRefs, error) {
+	c := &siteChecker{
+		roots:    siteRoots(outputFolder),
+		pages:    make(map[string]*checkedPage),
+		external: make(externalRefs),
+	}
+
+	// Find the pages
+	var locs []string
+	err := filepath.WalkDir(outputFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(p) == ".html" {
+			locs = append(locs, p)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Str("output_folder", outputFolder).Msg("could not find pages to check")
+		return nil, nil, err
+	}
+	sort.Strings(locs)
+
+	// Check their refs
+	var broken []brokenRef
+	for _, loc := range locs {
+		rel, err := filepath.Rel(outputFolder, loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		urlPath := "/" + filepath.ToSlash(rel)
+		short := strings.TrimSuffix(rel, ".html")
+
+		page, err := c.page(loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ref := range page.refs {
+			reason, err := c.checkRef(short, loc, urlPath, ref.Ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			if reason == "" {
+				continue
+			}
+			broken = append(broken, brokenRef{
+				Page:   short,
+				Kind:   ref.Kind,
+				Ref:    ref.Ref,
+				Reason: reason,
+			})
+		}
+	}
+	return broken, c.external, nil
+}
+
+// Gives a reason if ref (found on the page short, at loc, served at urlPath)
+// is broken.
+func (c *siteChecker) checkRef(short, loc, urlPath, ref string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "malformed link", nil
+	}
+
+	// Only check what is on the site
+	if u.Scheme != "" || u.Host != "" {
+		abs, ok := strings.CutPrefix(u.String(), site.LiveURL+"/")
+		if !ok {
+			if u.Scheme == "http" || u.Scheme == "https" {
+				c.external[u.String()] = append(c.external[u.String()], short)
+			}
+			return "", nil
+		}
+		u, err = url.Parse("/" + abs)
+		if err != nil {
+			return "malformed link", nil
+		}
+	}
+
+	// Find the file
+	target := loc
+	if u.Path != "" {
+		p := u.Path
+		if !strings.HasPrefix(p, "/") {
+			p = path.Join(path.Dir(urlPath), p)
+		}
+		var ok bool
+		target, ok = resolvePath(p, c.roots...)
+		if !ok {
+			return "missing target", nil
+		}
+	}
+
+	// Find the anchor
+	if u.Fragment == "" || filepath.Ext(target) != ".html" {
+		return "", nil
+	}
+	page, err := c.page(target)
+	if err != nil {
+		return "", err
+	}
+	if !page.ids[u.Fragment] {
+		return "missing anchor", nil
+	}
+	return "", nil
+}
+
+func (c *siteChecker) page(loc string) (*checkedPage, error) {
+	if page, ok := c.pages[loc]; ok {
+		return page, nil
+	}
+
+	f, err := os.Open(loc)
+	if err != nil {
+		log.Err(err).Str("loc", loc).Msg("could not open page to check")
+		return nil, err
+	}
+	defer f.Close()
+
+	page, err := parseCheckedPage(f)
+	if err != nil {
+		log.Err(err).Str("loc", loc).Msg("could not parse page to check")
+		return nil, err
+	}
+
+	c.pages[loc] = page
+	return page, nil
+}
+
+func parseCheckedPage(r io.Reader) (*checkedPage, error) {
+	page := &checkedPage{ids: make(map[string]bool)}
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		page.add(z.Token())
+	}
+	if err := z.Err(); !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Gives the anchors which links within the page point to, but which aren't
+// on it. Catches links left behind when a header is renamed.
+func missingOwnAnchors(b []byte) ([]string, error) {
+	page, err := parseCheckedPage(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, ref := range page.refs {
+		if !strings.HasPrefix(ref.Ref, "#") || ref.Ref == "#" {
+			continue
+		}
+		u, err := url.Parse(ref.Ref)
+		if err != nil || !page.ids[u.Fragment] {
+			missing = append(missing, ref.Ref)
+		}
+	}
+	return missing, nil
+}
+
+// Which attributes of which elements link to things on the site, and what
+// we call them.
+var refAttrs = map[string]map[string]string{
+	"a":      {"href": "link"},
+	"link":   {"href": "link"},
+	"img":    {"src": "image"},
+	"source": {"src": "source"},
+	"video":  {"src": "video", "poster": "image"},
+	"script": {"src": "script"},
+	"iframe": {"src": "frame"},
+}
+
+func (page *checkedPage) add(t html.Token) {
+	attrs := refAttrs[t.Data]
+	for _, attr := range t.Attr {
+		switch {
+		case attr.Key == "id" || (t.Data == "a" && attr.Key == "name"):
+			page.ids[attr.Val] = true
+		case attr.Key == "srcset" && (t.Data == "img" || t.Data == "source"):
+			// -> e.g. "/a-160.jpg 160w, /a-320.jpg 320w"
+			for _, candidate := range strings.Split(attr.Val, ",") {
+				fields := strings.Fields(candidate)
+				if len(fields) == 0 || skipRef(fields[0]) {
+					continue
+				}
+				page.refs = append(page.refs, pageRef{
+					Kind: "image",
+					Ref:  fields[0],
+				})
+			}
+		case attrs[attr.Key] != "":
+			if t.Data == "link" && !linksToResource(t) {
+				continue
+			}
+			if skipRef(attr.Val) {
+				continue
+			}
+			page.refs = append(page.refs, pageRef{
+				Kind: attrs[attr.Key],
+				Ref:  attr.Val,
+			})
+		}
+	}
+}
+
+// Some links (e.g. preconnect) are only hints, so needn't resolve.
+func linksToResource(t html.Token) bool {
+	for _, attr := range t.Attr {
+		if attr.Key != "rel" {
+			continue
+		}
+		for _, rel := range strings.Fields(attr.Val) {
+			switch rel {
+			case "preconnect", "dns-prefetch":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func skipRef(ref string) bool {
+	for _, scheme := range []string{"mailto:", "tel:", "javascript:", "data:"} {
+		if strings.HasPrefix(ref, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func reportExternal(results []linkrot.Result, external externalRefs) {
+	var dead, redirected int
+	for _, r := range results {
+		switch {
+		case r.Dead():
+			dead++
+			log.Warn().
+				Str("url", r.URL).
+				Int("status", r.Status).
+				Str("error", r.Error).
+				Strs("pages", external[r.URL]).
+				Msg("dead external link")
+		case r.Redirected():
+			redirected++
+			log.Info().
+				Str("url", r.URL).
+				Int("status", r.Status).
+				Str("location", r.Location).
+				Strs("pages", external[r.URL]).
+				Msg("redirected external link")
+		}
+	}
+	log.Info().
+		Int("checked", len(results)).
+		Int("dead", dead).
+		Int("redirected", redirected).
+		Msg("external links checked")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/andybalholm/brotli"
+	"github.com/rs/zerolog/log"
+)
+
+// Hosts which can serve precompressed files get a .gz and .br copy of each
+// text file, so they needn't compress on the fly (and can't do it better than
+// we can, given the time). Images and such are compressed already, so are
+// left alone.
+
+// Smaller files aren't worth it: the headers outweigh the saving.
+const compressMinSize = 1024
+
+// Extensions of the files worth compressing.
+var compressible = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".xml":  true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+}
+
+type compressor struct {
+	ext   string
+	write func(w io.Writer, b []byte) error
+}
+
+var compressors = []compressor{
+	{".gz", func(w io.Writer, b []byte) error {
+		zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		_, err = zw.Write(b)
+		if err != nil {
+			return err
+		}
+		return zw.Close()
+	}},
+	{".br", func(w io.Writer, b []byte) error {
+		bw := brotli.NewWriterLevel(w, brotli.BestCompression)
+		_, err := bw.Write(b)
+		if err != nil {
+			return err
+		}
+		return bw.Close()
+	}},
+}
+
+// Writes compressed copies of the files in folder which are worth it.
+func precompress(folder string) error {
+	var jobs []jobFn
+	err := filepath.WalkDir(folder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !compressible[filepath.Ext(p)] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < compressMinSize {
+			return nil
+		}
+		jobs = append(jobs, compressFile(folder, p))
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Str("folder", folder).Msg("could not find files to compress")
+		return err
+	}
+
+	return doAll(jobs...)
+}
+
+func compressFile(folder, loc string) jobFn {
+	return func() error {
+		b, err := os.ReadFile(loc)
+		if err != nil {
+			log.Err(err).Str("loc", loc).Msg("could not read file to compress")
+			return err
+		}
+
+		rel, _ := filepath.Rel(folder, loc)
+		event := log.Debug().Str("file", rel).Int("size", len(b))
+		for _, c := range compressors {
+			var buf bytes.Buffer
+			err := c.write(&buf, b)
+			if err == nil {
+				err = os.WriteFile(loc+c.ext, buf.Bytes(), 0664)
+			}
+			if err != nil {
+				log.Err(err).Str("loc", loc).Str("ext", c.ext).Msg("could not compress file")
+				return err
+			}
+			event = event.Str("ratio"+c.ext, fmt.Sprintf("%.2f", float64(buf.Len())/float64(len(b))))
+		}
+		event.Msg("compressed")
+		return nil
+	}
+}
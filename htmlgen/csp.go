@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// Pages in the deployable site say exactly what they may load, so an injected
+// script (or a tampered one from a CDN) won't run:
+// - Scripts and stylesheets they link to get an integrity attribute. Those
+//   from elsewhere must have theirs pinned in the template, as builds never
+//   fetch anything.
+// - Inline scripts are allowed by their hash, in a content security policy
+//   put in each page.
+// - Hosts which can set headers also get the policy as a header, which allows
+//   what any page needs (see hosting.go).
+//
+// This is done to the minified pages, as minifying changes what is hashed.
+
+// What a page may load, beyond the site itself.
+type contentPolicy struct {
+	scripts []string // External URLs, and hashes of inline scripts
+	styles  []string // External URLs
+}
+
+func (p contentPolicy) String() string {
+	return strings.Join([]string{
+		"default-src 'none'",
+		strings.Join(append([]string{"script-src 'self'"}, p.scripts...), " "),
+		strings.Join(append([]string{"style-src 'self'"}, p.styles...), " "),
+		"img-src 'self'",
+		"font-src 'self'",
+		"connect-src 'self'",
+		"base-uri 'none'",
+		"form-action 'self'",
+	}, "; ")
+}
+
+// As a header, which can say more than a page can.
+func (p contentPolicy) header() string {
+	// -> Pages can't be framed
+	return p.String() + "; frame-ancestors 'none'"
+}
+
+// Allows what either policy allows.
+func (p contentPolicy) union(other contentPolicy) contentPolicy {
+	return contentPolicy{
+		scripts: unionSorted(p.scripts, other.scripts),
+		styles:  unionSorted(p.styles, other.styles),
+	}
+}
+
+func unionSorted(a, b []string) []string {
+	u := append(slices.Clone(a), b...)
+	slices.Sort(u)
+	return slices.Compact(u)
+}
+
+type securer struct {
+	folder    string
+	integrity map[string]string // By path in folder
+}
+
+// Adds integrity attributes and a content security policy to the pages in
+// folder, returning a policy which allows what any of them need.
+func secureSite(folder string) (contentPolicy, error) {
+	s := &securer{
+		folder:    folder,
+		integrity: make(map[string]string),
+	}
+
+	var site contentPolicy
+	err := filepath.WalkDir(folder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".html" {
+			return err
+		}
+		rel, err := filepath.Rel(folder, p)
+		if err != nil {
+			return err
+		}
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		secured, policy, err := s.securePage("/"+filepath.ToSlash(rel), raw)
+		if err != nil {
+			log.Err(err).Str("file", p).Msg("could not secure page")
+			return err
+		}
+		site = site.union(policy)
+
+		// -> Replaces, as static pages are linked to the static folder
+		return writeOutputFile(p, secured)
+	})
+	return site, err
+}
+
+// Rewrites the page at p (e.g. /blog/index.html), returning it with the
+// policy it needs.
+func (s *securer) securePage(p string, page []byte) ([]byte, contentPolicy, error) {
+	var policy contentPolicy
+	var out bytes.Buffer
+	hasPolicy := false
+
+	z := html.NewTokenizer(bytes.NewReader(page))
+	inScript := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return nil, policy, z.Err()
+		}
+		raw := slices.Clone(z.Raw())
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			inScript = t.Data == "script" && tt == html.StartTagToken && !hasAttr(t, "src")
+
+			// -> Linked scripts and stylesheets
+			if src := linkedResource(t); src != "" {
+				integrity, external, err := s.integrityOf(p, t, src)
+				if err != nil {
+					return nil, policy, err
+				}
+				if external && t.Data == "script" {
+					policy.scripts = append(policy.scripts, src)
+				} else if external {
+					policy.styles = append(policy.styles, src)
+				}
+				if integrity != "" {
+					raw = insertAttrs(raw, fmt.Sprintf(` integrity="%s"`, integrity))
+				}
+			}
+			out.Write(raw)
+
+			// -> The policy goes as early as it can, as it only applies to
+			// what comes after it. Pages without a charset are fragments
+			// (e.g. snippets), which take the policy of the page they're put
+			// in.
+			if t.Data == "meta" && hasAttr(t, "charset") && !hasPolicy {
+				hasPolicy = true
+				out.WriteString(policyPlaceholder)
+			}
+
+		case html.TextToken:
+			// -> Inline scripts, including JSON-LD
+			if inScript && len(raw) > 0 {
+				sum := sha256.Sum256(raw)
+				hash := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+				policy.scripts = append(policy.scripts, hash)
+			}
+			out.Write(raw)
+
+		default:
+			inScript = false
+			out.Write(raw)
+		}
+	}
+
+	// -> Sorted, without repeats
+	policy = policy.union(contentPolicy{})
+	if !hasPolicy {
+		return out.Bytes(), policy, nil
+	}
+	meta := fmt.Sprintf(`<meta http-equiv=Content-Security-Policy content="%s">`, attrEscaper.Replace(policy.String()))
+	return bytes.Replace(out.Bytes(), []byte(policyPlaceholder), []byte(meta), 1), policy, nil
+}
+
+// Enough for a quoted attribute, keeping the policy readable.
+var attrEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;")
+
+// Marks where the policy goes, until it is known. Can't otherwise appear in
+// a page, as < would be escaped in text.
+const policyPlaceholder = "<htmlgen-content-security-policy>"
+
+// The URL of the script or stylesheet t links to, if it does.
+func linkedResource(t html.Token) string {
+	switch t.Data {
+	case "script":
+		return attr(t, "src")
+	case "link":
+		if slices.Contains(strings.Fields(attr(t, "rel")), "stylesheet") {
+			return attr(t, "href")
+		}
+	}
+	return ""
+}
+
+// Integrity to add to t, which links to src from the page at p. Empty if t
+// already has it.
+func (s *securer) integrityOf(p string, t html.Token, src string) (integrity string, external bool, err error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		log.Err(err).Str("src", src).Msg("could not parse linked resource")
+		return "", false, err
+	}
+	external = u.Host != ""
+	switch {
+	case hasAttr(t, "integrity"):
+		return "", external, nil
+	case external:
+		err = fmt.Errorf("%s has no integrity, pin it in the template", src)
+		log.Err(err).Str("page", p).Msg("external resource can't be hashed")
+		return "", external, err
+	}
+
+	key := path.Join(path.Dir(p), u.Path)
+	if strings.HasPrefix(u.Path, "/") {
+		key = u.Path
+	}
+	if integrity, ok := s.integrity[key]; ok {
+		return integrity, false, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.folder, filepath.FromSlash(key)))
+	if err != nil {
+		log.Err(err).Str("path", key).Msg("could not read linked resource")
+		return "", false, err
+	}
+	integrity = sriHash(content)
+	s.integrity[key] = integrity
+	return integrity, false, nil
+}
+
+func sriHash(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func attr(t html.Token, key string) string {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(t html.Token, key string) bool {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Puts attrs (with a leading space) at the end of the tag raw.
+func insertAttrs(raw []byte, attrs string) []byte {
+	end := len(raw) - 1
+	if bytes.HasSuffix(raw, []byte("/>")) {
+		end--
+	}
+	return slices.Concat(raw[:end], []byte(attrs), raw[end:])
+}
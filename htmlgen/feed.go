@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// Feeds let readers follow blog posts and digital restorations. We offer both
+// Atom and RSS, since readers vary in what they support.
+
+const (
+	feedTitle       = "Liam Pulles"
+	feedDescription = "Blog posts and digital restorations by Liam Pulles."
+	feedAuthor      = "Liam Pulles"
+)
+
+type feedPost struct {
+	site.DatedPost
+	URL     string
+	Content string // Rendered article body, with absolute links.
+}
+
+// Listed blog posts and restorations, latest first.
+func feedPosts() []site.DatedPost {
+	posts := append(listedPosts(site.BlogPosts), listedPosts(site.DigitalRestorations)...)
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date.After(posts[j].Date)
+	})
+	return posts
+}
+
+// Unlisted posts are on the site, but aren't to be found except by link.
+func listedPosts(posts []site.DatedPost) []site.DatedPost {
+	var listed []site.DatedPost
+	for _, post := range posts {
+		if post.Unlisted {
+			continue
+		}
+		listed = append(listed, post)
+	}
+	return listed
+}
+
+func renderFeedPosts(posts []site.DatedPost) ([]feedPost, error) {
+	var rendered []feedPost
+	for _, post := range posts {
+		// -> Readers show the title and date themselves, so skip the header.
+		var sb strings.Builder
+		sb.WriteString(string(post.Data.Article.RawContent))
+		for _, section := range post.Data.Article.Sections {
+			err := post.Template.ExecuteTemplate(&sb, "section", section)
+			if err != nil {
+				log.Err(err).
+					Str("short", post.Short).
+					Msg("could not template article for feed")
+				return nil, err
+			}
+		}
+
+		rendered = append(rendered, feedPost{
+			DatedPost: post,
+			URL:       fmt.Sprintf("%s/%s.html", site.LiveURL, post.Short),
+			Content:   absoluteLinks(sb.String()),
+		})
+	}
+	return rendered, nil
+}
+
+var (
+	rootRelativeRegex = regexp.MustCompile(`(href|src)="/([^/])`)
+	srcsetRegex       = regexp.MustCompile(`srcset="([^"]*)"`)
+)
+
+// Feed readers show content away from the site, so links must be absolute.
+func absoluteLinks(html string) string {
+	html = rootRelativeRegex.ReplaceAllString(html, `$1="`+site.LiveURL+`/$2`)
+
+	// -> Each candidate of a srcset, e.g. "/a-320.jpg 320w, /a-640.jpg 640w"
+	return srcsetRegex.ReplaceAllStringFunc(html, func(attr string) string {
+		candidates := strings.Split(srcsetRegex.FindStringSubmatch(attr)[1], ",")
+		for i, c := range candidates {
+			c = strings.TrimSpace(c)
+			if strings.HasPrefix(c, "/") && !strings.HasPrefix(c, "//") {
+				c = site.LiveURL + c
+			}
+			candidates[i] = c
+		}
+		return `srcset="` + strings.Join(candidates, ", ") + `"`
+	})
+}
+
+func feedUpdated(posts []site.DatedPost) time.Time {
+	var updated time.Time
+	for _, post := range posts {
+		if post.Date.After(updated) {
+			updated = post.Date
+		}
+	}
+	return updated
+}
+
+// ---
+// --- Atom
+// ---
+
+type atomFeedXML struct {
+	XMLName  xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string         `xml:"title"`
+	Subtitle string         `xml:"subtitle,omitempty"`
+	Links    []atomLinkXML  `xml:"link"`
+	ID       string         `xml:"id"`
+	Updated  string         `xml:"updated"`
+	Author   atomAuthorXML  `xml:"author"`
+	Entries  []atomEntryXML `xml:"entry"`
+}
+
+type atomLinkXML struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthorXML struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntryXML struct {
+	Title     string         `xml:"title"`
+	Links     []atomLinkXML  `xml:"link"`
+	ID        string         `xml:"id"`
+	Published string         `xml:"published"`
+	Updated   string         `xml:"updated"`
+	Summary   string         `xml:"summary,omitempty"`
+	Content   atomContentXML `xml:"content"`
+}
+
+type atomContentXML struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func atomFeed(posts []site.DatedPost) withFile {
+	return func(w io.Writer) error {
+		rendered, err := renderFeedPosts(posts)
+		if err != nil {
+			return err
+		}
+
+		feed := atomFeedXML{
+			Title:    feedTitle,
+			Subtitle: feedDescription,
+			Links: []atomLinkXML{
+				{Href: site.LiveURL + "/feed.xml", Rel: "self", Type: "application/atom+xml"},
+				{Href: site.LiveURL + "/", Rel: "alternate", Type: "text/html"},
+			},
+			ID:      site.LiveURL + "/",
+			Updated: feedUpdated(posts).Format(time.RFC3339),
+			Author: atomAuthorXML{
+				Name: feedAuthor,
+				URI:  site.LiveURL + "/biography.html",
+			},
+		}
+		for _, post := range rendered {
+			feed.Entries = append(feed.Entries, atomEntryXML{
+				Title: post.Data.Title,
+				Links: []atomLinkXML{
+					{Href: post.URL, Rel: "alternate", Type: "text/html"},
+				},
+				ID:        post.URL,
+				Published: post.Date.Format(time.RFC3339),
+				Updated:   post.Date.Format(time.RFC3339),
+				Summary:   post.Data.SEODescription,
+				Content: atomContentXML{
+					Type: "html",
+					Body: post.Content,
+				},
+			})
+		}
+
+		return writeXML(w, feed)
+	}
+}
+
+// ---
+// --- RSS
+// ---
+
+type rssXML struct {
+	XMLName   xml.Name      `xml:"rss"`
+	Version   string        `xml:"version,attr"`
+	AtomNS    string        `xml:"xmlns:atom,attr"`
+	ContentNS string        `xml:"xmlns:content,attr"`
+	Channel   rssChannelXML `xml:"channel"`
+}
+
+type rssChannelXML struct {
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Description   string       `xml:"description"`
+	AtomLink      atomLinkXML  `xml:"atom:link"`
+	LastBuildDate string       `xml:"lastBuildDate"`
+	Items         []rssItemXML `xml:"item"`
+}
+
+type rssItemXML struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link"`
+	GUID        rssGUIDXML `xml:"guid"`
+	PubDate     string     `xml:"pubDate"`
+	Description string     `xml:"description"`
+	Content     string     `xml:"content:encoded"`
+}
+
+type rssGUIDXML struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Body        string `xml:",chardata"`
+}
+
+func rssFeed(posts []site.DatedPost) withFile {
+	return func(w io.Writer) error {
+		rendered, err := renderFeedPosts(posts)
+		if err != nil {
+			return err
+		}
+
+		feed := rssXML{
+			Version:   "2.0",
+			AtomNS:    "http://www.w3.org/2005/Atom",
+			ContentNS: "http://purl.org/rss/1.0/modules/content/",
+			Channel: rssChannelXML{
+				Title:       feedTitle,
+				Link:        site.LiveURL + "/",
+				Description: feedDescription,
+				AtomLink: atomLinkXML{
+					Href: site.LiveURL + "/rss.xml",
+					Rel:  "self",
+					Type: "application/rss+xml",
+				},
+				LastBuildDate: feedUpdated(posts).Format(time.RFC1123Z),
+			},
+		}
+		for _, post := range rendered {
+			feed.Channel.Items = append(feed.Channel.Items, rssItemXML{
+				Title: post.Data.Title,
+				Link:  post.URL,
+				GUID: rssGUIDXML{
+					IsPermaLink: true,
+					Body:        post.URL,
+				},
+				PubDate:     post.Date.Format(time.RFC1123Z),
+				Description: post.Data.SEODescription,
+				Content:     post.Content,
+			})
+		}
+
+		return writeXML(w, feed)
+	}
+}
+
+func writeXML(w io.Writer, v any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		log.Err(err).Msg("could not write xml header")
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(v)
+	if err != nil {
+		log.Err(err).Msg("could not write xml")
+		return fmt.Errorf("could not write xml: %w", err)
+	}
+	return nil
+}
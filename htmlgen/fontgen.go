@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/fonts"
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// Fonts are served by the site rather than a font host, cut down to the
+// characters pages actually use. That can only be known once pages are made,
+// but pages link to the fonts by fingerprint (see assets.go). So pages are
+// first made linking to the last build's fonts, and made again if they
+// change.
+
+// Where the TrueType files of the fonts are kept.
+const fontsFolder = "_fonts"
+
+type fontFace struct {
+	family string
+	file   string // In fontsFolder
+}
+
+var fontFaces = []fontFace{
+	{"Source Sans Pro", "SourceSansPro-Regular.ttf"},
+	{"Fraunces", "Fraunces-Regular.ttf"},
+}
+
+// Goes with the fonts of the last build, if there was one.
+func lastFontAssets(outputFolder string, assets map[string]string) {
+	assets["/fonts.css"] = "/fonts.css"
+
+	raw, err := os.ReadFile(filepath.Join(outputFolder, assetManifestFile))
+	if err != nil {
+		return
+	}
+	var last map[string]string
+	err = json.Unmarshal(raw, &last)
+	if err != nil {
+		log.Debug().Err(err).Msg("could not read last asset manifest")
+		return
+	}
+	for p, name := range last {
+		if p == "/fonts.css" || strings.HasPrefix(p, "/fonts/") {
+			assets[p] = name
+		}
+	}
+}
+
+// Makes the fonts for the pages made by pageJobs, making them again if they
+// linked to other fonts. The asset manifest is written last, once all names
+// are known.
+func genFonts(b *build, assets map[string]string, pageJobs []jobFn) error {
+	used, err := usedRunes(b.stagingFolder)
+	if err != nil {
+		return err
+	}
+
+	before := maps.Clone(assets)
+	jobs, err := fontJobs(b, assets, used)
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(before, assets) {
+		log.Debug().Msg("fonts have changed, making pages again")
+		site.SetAssets(assets)
+		b.setAssets(assets)
+		b.skipped, b.unchanged, b.wrote = 0, 0, 0
+		err = doAll(pageJobs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	jobs = append(jobs, b.fileJob(assetManifestFile, assets, writeAssetManifest(assets)))
+	return doAll(jobs...)
+}
+
+func fontJobs(b *build, assets map[string]string, used []rune) ([]jobFn, error) {
+	var jobs []jobFn
+	var css strings.Builder
+	for _, face := range fontFaces {
+		loc := filepath.Join(fontsFolder, face.file)
+		ttf, err := os.ReadFile(loc)
+		if errors.Is(err, os.ErrNotExist) {
+			// -> Pages fall back to a font of the same kind
+			log.Warn().Str("loc", loc).Msg("missing font, pages won't have it")
+			continue
+		}
+		if err != nil {
+			log.Err(err).Str("loc", loc).Msg("could not read font")
+			return nil, err
+		}
+
+		subset, err := fonts.Subset(ttf, used)
+		if err == nil {
+			subset, err = fonts.WOFF(subset)
+		}
+		if err != nil {
+			log.Err(err).Str("loc", loc).Msg("could not subset font")
+			return nil, err
+		}
+
+		p := "/fonts/" + strings.TrimSuffix(face.file, filepath.Ext(face.file)) + ".woff"
+		name := fingerprinted(p, subset)
+		assets[p] = name
+		jobs = append(jobs, b.fileJob(strings.TrimPrefix(name, "/"), hashBytes(subset), writeBytes(subset)))
+
+		fmt.Fprintf(&css, `@font-face {
+    font-family: '%s';
+    font-style: normal;
+    font-weight: 400;
+    font-display: swap;
+    src: url(%s) format('woff');
+    unicode-range: %s;
+}
+`, face.family, name, unicodeRange(used))
+		log.Debug().
+			Str("font", face.family).
+			Int("original", len(ttf)).
+			Int("subset", len(subset)).
+			Msg("subset font")
+	}
+
+	content := []byte(css.String())
+	name := fingerprinted("/fonts.css", content)
+	assets["/fonts.css"] = name
+	jobs = append(jobs, b.fileJob(strings.TrimPrefix(name, "/"), hashBytes(content), writeBytes(content)))
+	return jobs, nil
+}
+
+// Every character which might be shown in a font: the text of every page, and
+// any in the stylesheet and script (e.g. CSS content, or search results).
+// Printable ASCII is always included, for what pages are given later (e.g.
+// search queries).
+func usedRunes(folder string) ([]rune, error) {
+	used := make(map[rune]bool)
+	for r := rune(0x20); r < 0x7f; r++ {
+		used[r] = true
+	}
+	addText := func(s string) {
+		for _, r := range s {
+			if r > 0x20 {
+				used[r] = true
+			}
+		}
+	}
+
+	// -> Pages
+	err := filepath.WalkDir(folder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".html" {
+			return err
+		}
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		addPageText(raw, addText)
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Str("folder", folder).Msg("could not read pages for their text")
+		return nil, err
+	}
+
+	// -> Stylesheet and script
+	for _, file := range []string{"style.css", "script.js"} {
+		raw, err := os.ReadFile(filepath.Join(staticMinableFolder, file))
+		if err != nil {
+			log.Err(err).Str("file", file).Msg("could not read for its text")
+			return nil, err
+		}
+		addText(string(raw))
+	}
+
+	var runes []rune
+	for r := range used {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes, nil
+}
+
+// Text outside of scripts and styles, and attributes which are shown.
+func addPageText(page []byte, add func(string)) {
+	z := html.NewTokenizer(bytes.NewReader(page))
+	skip := ""
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.Data == "script" || t.Data == "style" {
+				skip = t.Data
+			}
+			for _, attr := range t.Attr {
+				if attr.Key == "placeholder" || attr.Key == "value" || attr.Key == "title" || attr.Key == "alt" {
+					add(attr.Val)
+				}
+			}
+		case html.EndTagToken:
+			if t := z.Token(); t.Data == skip {
+				skip = ""
+			}
+		case html.TextToken:
+			if skip == "" {
+				add(string(z.Text()))
+			}
+		}
+	}
+}
+
+// E.g. U+20-7E, U+E9
+func unicodeRange(runes []rune) string {
+	var parts []string
+	for i := 0; i < len(runes); {
+		j := i
+		for j+1 < len(runes) && runes[j+1] == runes[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprintf("U+%X", runes[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("U+%X-%X", runes[i], runes[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,372 @@
+// Package fonts cuts TrueType fonts down to the characters a site uses, and
+// packs them as WOFF for browsers.
+package fonts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// Tables which are left out of subsets:
+// - GSUB would swap in glyphs (e.g. ligatures) which may not be kept.
+// - Variations would need subsetting too, so subsets are the default instance.
+// - A signature would no longer match.
+var droppedTables = map[string]bool{
+	"GSUB": true,
+	"morx": true,
+	"fvar": true,
+	"gvar": true,
+	"avar": true,
+	"cvar": true,
+	"HVAR": true,
+	"VVAR": true,
+	"MVAR": true,
+	"STAT": true,
+	"DSIG": true,
+}
+
+type table struct {
+	tag  string
+	data []byte
+}
+
+// Subset keeps only the glyphs needed for runes (and those they are made
+// from). Glyph IDs don't change, so metrics and kerning still apply; other
+// glyphs are just left empty. Only TrueType outlines are supported.
+func Subset(ttf []byte, runes []rune) ([]byte, error) {
+	f, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse font: %w", err)
+	}
+	tables, err := readTables(ttf)
+	if err != nil {
+		return nil, err
+	}
+	byTag := make(map[string][]byte)
+	for _, t := range tables {
+		byTag[t.tag] = t.data
+	}
+	for _, tag := range []string{"head", "maxp", "loca", "glyf", "cmap"} {
+		if byTag[tag] == nil {
+			return nil, fmt.Errorf("font has no %s table (only TrueType outlines can be subset)", tag)
+		}
+	}
+
+	// -> Which glyphs each rune is
+	var buf sfnt.Buffer
+	chars := make(map[rune]uint16)
+	for _, r := range runes {
+		gid, err := f.GlyphIndex(&buf, r)
+		if err != nil {
+			return nil, fmt.Errorf("could not look up %q: %w", r, err)
+		}
+		if gid != 0 {
+			chars[r] = uint16(gid)
+		}
+	}
+
+	// -> Keep those, and what they are made from
+	numGlyphs := int(binary.BigEndian.Uint16(byTag["maxp"][4:]))
+	longLoca := int16(binary.BigEndian.Uint16(byTag["head"][50:])) == 1
+	glyphs, err := splitGlyphs(byTag["glyf"], byTag["loca"], numGlyphs, longLoca)
+	if err != nil {
+		return nil, err
+	}
+	keep := map[uint16]bool{0: true} // .notdef
+	for _, gid := range chars {
+		err := keepGlyph(glyphs, gid, keep)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// -> Rewrite what changes
+	var subset []table
+	for _, t := range tables {
+		switch {
+		case droppedTables[t.tag]:
+			continue
+		case t.tag == "glyf":
+			glyf, loca := joinGlyphs(glyphs, keep)
+			subset = append(subset, table{"glyf", glyf}, table{"loca", loca})
+		case t.tag == "loca":
+			// -> Made with glyf
+		case t.tag == "head":
+			head := bytes.Clone(t.data)
+			binary.BigEndian.PutUint32(head[8:], 0)  // Checksum adjustment, set by writeSfnt
+			binary.BigEndian.PutUint16(head[50:], 1) // Long loca
+			subset = append(subset, table{"head", head})
+		case t.tag == "cmap":
+			subset = append(subset, table{"cmap", makeCmap(chars)})
+		default:
+			subset = append(subset, t)
+		}
+	}
+	return writeSfnt(binary.BigEndian.Uint32(ttf), subset), nil
+}
+
+func readTables(b []byte) ([]table, error) {
+	if len(b) < 12 {
+		return nil, errors.New("font is too short")
+	}
+	numTables := int(binary.BigEndian.Uint16(b[4:]))
+	if len(b) < 12+16*numTables {
+		return nil, errors.New("font table directory is cut off")
+	}
+
+	var tables []table
+	for i := range numTables {
+		rec := b[12+16*i:]
+		offset := binary.BigEndian.Uint32(rec[8:])
+		length := binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(b)) {
+			return nil, fmt.Errorf("font table %s is cut off", rec[:4])
+		}
+		tables = append(tables, table{
+			tag:  string(rec[:4]),
+			data: b[offset : offset+length],
+		})
+	}
+	return tables, nil
+}
+
+func splitGlyphs(glyf, loca []byte, numGlyphs int, longLoca bool) ([][]byte, error) {
+	offset := func(i int) int {
+		if longLoca {
+			return int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+		return 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+	}
+	size := 2
+	if longLoca {
+		size = 4
+	}
+	if len(loca) < (numGlyphs+1)*size {
+		return nil, errors.New("font loca table is cut off")
+	}
+
+	glyphs := make([][]byte, numGlyphs)
+	for i := range numGlyphs {
+		start, end := offset(i), offset(i+1)
+		if start > end || end > len(glyf) {
+			return nil, fmt.Errorf("glyph %d is out of bounds", i)
+		}
+		glyphs[i] = glyf[start:end]
+	}
+	return glyphs, nil
+}
+
+// Composite glyph flags
+const (
+	argsAreWords   = 0x0001
+	haveScale      = 0x0008
+	moreComponents = 0x0020
+	haveXYScale    = 0x0040
+	haveTwoByTwo   = 0x0080
+)
+
+func keepGlyph(glyphs [][]byte, gid uint16, keep map[uint16]bool) error {
+	if int(gid) >= len(glyphs) {
+		return fmt.Errorf("glyph %d is out of bounds", gid)
+	}
+	keep[gid] = true
+
+	// -> Composite glyphs are made from others
+	g := glyphs[gid]
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	for p := 10; p+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[p:])
+		component := binary.BigEndian.Uint16(g[p+2:])
+		if !keep[component] {
+			err := keepGlyph(glyphs, component, keep)
+			if err != nil {
+				return err
+			}
+		}
+
+		p += 4
+		if flags&argsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			p += 2
+		case flags&haveXYScale != 0:
+			p += 4
+		case flags&haveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// Gives glyf and (long) loca tables with only the kept glyphs filled in.
+func joinGlyphs(glyphs [][]byte, keep map[uint16]bool) ([]byte, []byte) {
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(len(glyphs)+1))
+	for i, g := range glyphs {
+		binary.BigEndian.PutUint32(loca[4*i:], uint32(glyf.Len()))
+		if !keep[uint16(i)] {
+			continue
+		}
+		glyf.Write(g)
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*len(glyphs):], uint32(glyf.Len()))
+	return glyf.Bytes(), loca
+}
+
+// Maps only chars, so browsers use another font for anything else. Windows
+// Unicode BMP (format 4) is the one everything reads; anything beyond the BMP
+// goes in a Windows Unicode full (format 12) table.
+func makeCmap(chars map[rune]uint16) []byte {
+	var codes []rune
+	for r := range chars {
+		codes = append(codes, r)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+
+	// -> Runs of consecutive characters with consecutive glyphs
+	type run struct {
+		start, end rune
+		gid        uint16
+	}
+	var runs []run
+	for _, r := range codes {
+		if n := len(runs); n > 0 && runs[n-1].end == r-1 && chars[r] == runs[n-1].gid+uint16(r-runs[n-1].start) {
+			runs[n-1].end = r
+			continue
+		}
+		runs = append(runs, run{r, r, chars[r]})
+	}
+
+	// -> Format 4, for the BMP
+	var bmp []run
+	for _, r := range runs {
+		if r.start > 0xFFFE {
+			break
+		}
+		r.end = min(r.end, 0xFFFE)
+		bmp = append(bmp, r)
+	}
+	bmp = append(bmp, run{0xFFFF, 0xFFFF, 0}) // Required
+	segCount := len(bmp)
+	searchRange := 2
+	entrySelector := 0
+	for searchRange*2 <= 2*segCount {
+		searchRange *= 2
+		entrySelector++
+	}
+	var f4 bytes.Buffer
+	put := func(b *bytes.Buffer, v ...uint16) {
+		for _, x := range v {
+			binary.Write(b, binary.BigEndian, x)
+		}
+	}
+	put(&f4, 4, uint16(16+8*segCount), 0, uint16(2*segCount), uint16(searchRange), uint16(entrySelector), uint16(2*segCount-searchRange))
+	for _, r := range bmp {
+		put(&f4, uint16(r.end))
+	}
+	put(&f4, 0)
+	for _, r := range bmp {
+		put(&f4, uint16(r.start))
+	}
+	for _, r := range bmp {
+		put(&f4, r.gid-uint16(r.start))
+	}
+	for range bmp {
+		put(&f4, 0)
+	}
+
+	// -> Format 12, if needed
+	var f12 bytes.Buffer
+	if len(runs) > 0 && runs[len(runs)-1].end > 0xFFFF {
+		binary.Write(&f12, binary.BigEndian, []uint32{12 << 16, uint32(16 + 12*len(runs)), 0, uint32(len(runs))})
+		for _, r := range runs {
+			binary.Write(&f12, binary.BigEndian, []uint32{uint32(r.start), uint32(r.end), uint32(r.gid)})
+		}
+	}
+
+	var cmap bytes.Buffer
+	if f12.Len() == 0 {
+		put(&cmap, 0, 1, 3, 1)
+		binary.Write(&cmap, binary.BigEndian, uint32(12))
+		cmap.Write(f4.Bytes())
+		return cmap.Bytes()
+	}
+	put(&cmap, 0, 2, 3, 1)
+	binary.Write(&cmap, binary.BigEndian, uint32(20))
+	put(&cmap, 3, 10)
+	binary.Write(&cmap, binary.BigEndian, uint32(20+f4.Len()))
+	cmap.Write(f4.Bytes())
+	cmap.Write(f12.Bytes())
+	return cmap.Bytes()
+}
+
+// Puts tables back together into a font.
+func writeSfnt(version uint32, tables []table) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	n := len(tables)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= n {
+		searchRange *= 2
+		entrySelector++
+	}
+	searchRange *= 16
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, version)
+	binary.Write(&out, binary.BigEndian, []uint16{uint16(n), uint16(searchRange), uint16(entrySelector), uint16(n*16 - searchRange)})
+
+	offset := 12 + 16*n
+	var headAt int
+	for _, t := range tables {
+		if t.tag == "head" {
+			headAt = offset
+		}
+		out.WriteString(t.tag)
+		binary.Write(&out, binary.BigEndian, []uint32{checksum(t.data), uint32(offset), uint32(len(t.data))})
+		offset += pad4(len(t.data))
+	}
+	for _, t := range tables {
+		out.Write(t.data)
+		out.Write(make([]byte, pad4(len(t.data))-len(t.data)))
+	}
+
+	// -> So the whole font sums to a magic number
+	b := out.Bytes()
+	if headAt > 0 {
+		binary.BigEndian.PutUint32(b[headAt+8:], 0)
+		binary.BigEndian.PutUint32(b[headAt+8:], 0xB1B0AFBA-checksum(b))
+	}
+	return b
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
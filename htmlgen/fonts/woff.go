@@ -0,0 +1,61 @@
+package fonts
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+)
+
+// WOFF packs a font for browsers: the same tables, but each compressed.
+func WOFF(font []byte) ([]byte, error) {
+	tables, err := readTables(font)
+	if err != nil {
+		return nil, err
+	}
+
+	const headerSize, entrySize = 44, 20
+	n := len(tables)
+	offset := headerSize + entrySize*n
+	sfntSize := 12 + 16*n
+	var dir, data bytes.Buffer
+	for _, t := range tables {
+		stored := t.data
+		var z bytes.Buffer
+		zw, err := zlib.NewWriterLevel(&z, zlib.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		zw.Write(t.data)
+		err = zw.Close()
+		if err != nil {
+			return nil, err
+		}
+		// -> Only kept compressed if it is smaller
+		if z.Len() < len(t.data) {
+			stored = z.Bytes()
+		}
+
+		dir.WriteString(t.tag)
+		binary.Write(&dir, binary.BigEndian, []uint32{
+			uint32(offset + data.Len()),
+			uint32(len(stored)),
+			uint32(len(t.data)),
+			checksum(t.data),
+		})
+		data.Write(stored)
+		data.Write(make([]byte, pad4(len(stored))-len(stored)))
+		sfntSize += pad4(len(t.data))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("wOFF")
+	binary.Write(&out, binary.BigEndian, binary.BigEndian.Uint32(font)) // Flavour
+	binary.Write(&out, binary.BigEndian, uint32(offset+data.Len()))
+	binary.Write(&out, binary.BigEndian, []uint16{uint16(n), 0})
+	binary.Write(&out, binary.BigEndian, uint32(sfntSize))
+	binary.Write(&out, binary.BigEndian, []uint16{1, 0})          // Version
+	binary.Write(&out, binary.BigEndian, []uint32{0, 0, 0, 0, 0}) // No metadata or private data
+	out.Write(dir.Bytes())
+	out.Write(data.Bytes())
+	return out.Bytes(), nil
+}
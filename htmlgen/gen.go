@@ -1,61 +1,169 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
 	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/liampulles/liampulles.github.io/htmlgen/letterboxd"
 	"github.com/liampulles/liampulles.github.io/htmlgen/site"
 	"github.com/rs/zerolog/log"
 )
 
-func GenSite(outputFolder string) error {
-	// Delete the folder, start fresh
-	err := deleteFolder(outputFolder)
+type GenConfig struct {
+	OutputFolder string
+	// Folder of markdown blog posts, to go alongside those defined in Go.
+	ContentFolder string
+	// If set, render drafts under /drafts/ for previewing.
+	Drafts bool
+}
+
+func GenSite(cfg GenConfig) error {
+	outputFolder := cfg.OutputFolder
+	sitemapShorts = nil
+
+	// Load file based content
+	err := site.LoadBlogContent(cfg.ContentFolder)
+	if err != nil {
+		return err
+	}
+	site.LinkPosts()
+
+	// Pick up where the last build left off
+	b, err := newBuild(outputFolder)
 	if err != nil {
 		return err
 	}
 
 	// Do some HTML templating, and stylesheet writing
-	// -> HTML
-	var jobs []jobFn
-	indexPage := site.IndexPage()
+	// -> HTML. Pages are kept apart, as they are made again if the fonts change.
+	var pageJobs, jobs []jobFn
+	indexPage, err := site.IndexPage()
+	if err != nil {
+		return err
+	}
 	notFoundPage := site.NotFoundPage()
-	jobs = append(jobs, genJob(outputFolder, notFoundPage.Short, page(notFoundPage)))
-	jobs = append(jobs, genJob(outputFolder, indexPage.Short, page(indexPage)))
-	jobs = append(jobs, genJob(outputFolder, site.BiographyPage.Short, page(site.BiographyPage)))
-	reviewsPage := site.ReviewsPage()
-	jobs = append(jobs, genJob(outputFolder, reviewsPage.Short, page(reviewsPage)))
+	pageJobs = append(pageJobs, b.genJob(notFoundPage.Short, notFoundPage.Data, page(notFoundPage)))
+	pageJobs = append(pageJobs, b.genJob(indexPage.Short, indexPage.Data, page(indexPage)))
+	pageJobs = append(pageJobs, b.genJob(site.BiographyPage.Short, site.BiographyPage.Data, page(site.BiographyPage)))
+	searchPage := site.SearchPage()
+	pageJobs = append(pageJobs, b.genJob(searchPage.Short, searchPage.Data, page(searchPage)))
+	// -> Reviews are expensive, so only make them if the export has changed.
+	reviewsExport, err := letterboxd.ExportFingerprint()
+	if err != nil {
+		return err
+	}
+	sitemapShorts = append(sitemapShorts, site.ReviewsShort)
+	pageJobs = append(pageJobs, b.genJob(site.ReviewsShort, reviewsExport, func(w io.Writer) error {
+		return hiddenPage(site.ReviewsPage())(w)
+	}))
 	for _, blogPage := range site.BlogPosts {
-		jobs = append(jobs, genJob(outputFolder, blogPage.Page.Short, page(blogPage.Page)))
+		pageJobs = append(pageJobs, b.genJob(blogPage.Page.Short, blogPage.Page.Data, page(blogPage.Page)))
 	}
 	for _, dr := range site.DigitalRestorations {
-		jobs = append(jobs, genJob(outputFolder, dr.Page.Short, page(dr.Page)))
+		pageJobs = append(pageJobs, b.genJob(dr.Page.Short, dr.Page.Data, page(dr.Page)))
+	}
+	tagPages, err := site.TagPages()
+	if err != nil {
+		return err
+	}
+	for _, tagPage := range tagPages {
+		pageJobs = append(pageJobs, b.genJob(tagPage.Short, tagPage.Data, page(tagPage)))
 	}
 	for _, r := range site.RedirectPages {
-		jobs = append(jobs, genJob(outputFolder, r.Short, redirect(r)))
+		jobs = append(jobs, b.genJob(r.Short, r.Dest, redirect(r)))
 	}
 	for _, s := range site.Snippets {
-		jobs = append(jobs, genJob(outputFolder, "snippet/"+s.Short, snippet(s)))
+		jobs = append(jobs, b.genJob("snippet/"+s.Short, s.Content, snippet(s)))
+	}
+	if cfg.Drafts {
+		draftPageJobs, draftJobs, err := genDrafts(b)
+		if err != nil {
+			return err
+		}
+		pageJobs = append(pageJobs, draftPageJobs...)
+		jobs = append(jobs, draftJobs...)
+	}
+	// -> Images, in every width pages offer
+	assets := make(map[string]string)
+	resizeJobs, err := imageJobs(b, assets)
+	if err != nil {
+		return err
 	}
-	// -> CSS
-	jobs = append(jobs, writeStyle(outputFolder, "monokai", "dark"))
-	jobs = append(jobs, writeStyle(outputFolder, "tango", "light"))
+	jobs = append(jobs, resizeJobs...)
+	// -> Stylesheets, scripts and such, which pages need the names of
+	fingerprintJobs, err := assetJobs(b, assets)
+	if err != nil {
+		return err
+	}
+	jobs = append(jobs, fingerprintJobs...)
+	lastFontAssets(outputFolder, assets)
+	site.SetAssets(assets)
+	b.setAssets(assets)
+	// -> Link preview cards
+	cardPages := []site.Page{notFoundPage, indexPage, site.BiographyPage, searchPage}
+	for _, post := range site.BlogPosts {
+		cardPages = append(cardPages, post.Page)
+	}
+	for _, dr := range site.DigitalRestorations {
+		cardPages = append(cardPages, dr.Page)
+	}
+	cardPages = append(cardPages, tagPages...)
+	jobs = append(jobs, ogCardJobs(b, cardPages...)...)
 	// -> Sitemap
-	jobs = append(jobs, writeSitemap(outputFolder))
-	// -> Javascript
-	jobs = append(jobs, writeMaybePages(outputFolder))
+	jobs = append(jobs, b.fileJob("sitemap.xml", sitemapShorts, writeSitemap(sitemapShorts)))
+	// -> Search
+	searchInputs := []any{snippetsInputs(site.Snippets), reviewsExport}
+	for _, kind := range searchPostKinds() {
+		searchInputs = append(searchInputs, postsInputs(kind.posts))
+	}
+	jobs = append(jobs, b.fileJob(searchIndexFile, searchInputs, writeSearchIndex()))
+	// -> Feeds
+	posts := feedPosts()
+	jobs = append(jobs, b.fileJob("feed.xml", postsInputs(posts), atomFeed(posts)))
+	jobs = append(jobs, b.fileJob("rss.xml", postsInputs(posts), rssFeed(posts)))
+	jobs = append(jobs, b.fileJob("reviews.xml", reviewsExport, reviewsAtomFeed()))
+	jobs = append(jobs, b.fileJob("reviews.json", reviewsExport, reviewsJSONFeed()))
+
+	err = doAll(slices.Concat(pageJobs, jobs)...)
+	// -> Fonts, now that we know what pages use
+	if err == nil {
+		err = genFonts(b, assets, pageJobs)
+	}
+	return b.finish(err)
+}
+
+// Drafts are hidden pages: they are not in the sitemap, maybe pages or index.
+// Their pages are given apart from their other files, e.g. link preview cards.
+func genDrafts(b *build) (pageJobs []jobFn, jobs []jobFn, err error) {
+	drafts, err := site.LoadDrafts(site.DraftsFolder)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return doAll(jobs...)
+	for _, draft := range drafts {
+		pageJobs = append(pageJobs, b.genJob(draft.Short, draft.Data, hiddenPage(draft.Page)))
+		jobs = append(jobs, ogCardJobs(b, draft.Page)...)
+	}
+	draftsIndex := site.DraftsIndexPage(drafts)
+	pageJobs = append(pageJobs, b.genJob(draftsIndex.Short, draftsIndex.Data, hiddenPage(draftsIndex)))
+	jobs = append(jobs, ogCardJobs(b, draftsIndex)...)
+
+	log.Info().
+		Int("drafts", len(drafts)).
+		Str("index", draftsIndex.Short+".html").
+		Msg("rendering drafts")
+	return pageJobs, jobs, nil
 }
 
 func deleteFolder(outputFolder string) error {
@@ -70,86 +178,13 @@ func deleteFolder(outputFolder string) error {
 	return nil
 }
 
-func genJob(outputFolder string, short string, with withFile) jobFn {
-	return func() error {
-		loc := path.Join(outputFolder, short+".html")
-
-		// Make folder
-		dir := filepath.Dir(loc)
-		err := os.MkdirAll(dir, os.ModePerm)
-		if err != nil {
-			log.Err(err).
-				Str("dir", dir).
-				Msg("could not make output dir, failing")
-			return err
-		}
-
-		// Open the file
-		w, err := os.Create(loc)
-		if err != nil {
-			log.Err(err).
-				Str("loc", loc).
-				Msg("could not create output file, failing")
-			return err
-		}
-		// -> Close it later
-		defer func() {
-			cErr := w.Close()
-			if cErr != nil {
-				log.Err(cErr).
-					Str("loc", loc).
-					Msg("could not close output file, failing")
-			}
-			err = errors.Join(err, cErr)
-		}()
-
-		// Use file
-		err = with(w)
-		if err != nil {
-			return err
-		}
-
-		log.Debug().Str("file", loc).Msg("generated")
-		return nil
-	}
-}
-
 type withFile func(io.Writer) error
 
 // Should only contain meaningful, "actual" pages (no redirects)
 var sitemapShorts []string
 
-func writeSitemap(outputFolder string) jobFn {
-	return func() error {
-		// Make folder
-		err := os.MkdirAll(outputFolder, os.ModePerm)
-		if err != nil {
-			log.Err(err).
-				Str("dir", outputFolder).
-				Msg("could not make output dir, failing")
-			return err
-		}
-
-		loc := path.Join(outputFolder, "sitemap.xml")
-		// Open the file
-		w, err := os.Create(loc)
-		if err != nil {
-			log.Err(err).
-				Str("loc", loc).
-				Msg("could not create output file, failing")
-			return err
-		}
-		// -> Close it later
-		defer func() {
-			cErr := w.Close()
-			if cErr != nil {
-				log.Err(cErr).
-					Str("loc", loc).
-					Msg("could not close output file, failing")
-			}
-			err = errors.Join(err, cErr)
-		}()
-
+func writeSitemap(shorts []string) withFile {
+	return func(w io.Writer) error {
 		// Template XML
 		type sitemapURL struct {
 			Location string `xml:"loc"`
@@ -158,7 +193,7 @@ func writeSitemap(outputFolder string) jobFn {
 			XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
 			URLs    []sitemapURL `xml:"url"`
 		}
-		for _, short := range sitemapShorts {
+		for _, short := range shorts {
 			sitemapURLSet.URLs = append(sitemapURLSet.URLs, sitemapURL{
 				Location: fmt.Sprintf("%s/%s.html", site.LiveURL, short),
 			})
@@ -166,16 +201,14 @@ func writeSitemap(outputFolder string) jobFn {
 		xmlBytes, err := xml.Marshal(sitemapURLSet)
 		if err != nil {
 			log.Err(err).
-				Str("loc", loc).
 				Msg("could not marshal sitemap xml")
 			return fmt.Errorf("invalid sitemap xml: %w", err)
 		}
 
-		// Write it to file
+		// Write it out
 		_, err = w.Write(xmlBytes)
 		if err != nil {
 			log.Err(err).
-				Str("loc", loc).
 				Msg("could not write sitemap xml")
 			return fmt.Errorf("could not write sitemap xml: %w", err)
 		}
@@ -184,73 +217,46 @@ func writeSitemap(outputFolder string) jobFn {
 	}
 }
 
-func writeMaybePages(outputFolder string) jobFn {
-	return func() error {
-		// Make folder
-		err := os.MkdirAll(outputFolder, os.ModePerm)
-		if err != nil {
-			log.Err(err).
-				Str("dir", outputFolder).
-				Msg("could not make output dir, failing")
-			return err
-		}
-
-		loc := path.Join(outputFolder, "maybe_pages.js")
-		// Open the file
-		w, err := os.Create(loc)
-		if err != nil {
-			log.Err(err).
-				Str("loc", loc).
-				Msg("could not create output file, failing")
-			return err
-		}
-		// -> Close it later
-		defer func() {
-			cErr := w.Close()
-			if cErr != nil {
-				log.Err(cErr).
-					Str("loc", loc).
-					Msg("could not close output file, failing")
-			}
-			err = errors.Join(err, cErr)
-		}()
+type maybePage struct {
+	Location string `json:"location"`
+	Title    string `json:"title"`
+}
 
-		// Build a set of suggestions
-		type maybePage struct {
-			Location string `json:"location"`
-			Title    string `json:"title"`
-		}
-		var maybes []maybePage
-		for _, post := range site.BlogPosts {
-			maybes = append(maybes, maybePage{
-				Location: fmt.Sprintf("%s/%s.html", site.LiveURL, post.Short),
-				Title:    post.Page.Data.Title,
-			})
-		}
-		for _, post := range site.DigitalRestorations {
-			maybes = append(maybes, maybePage{
-				Location: fmt.Sprintf("%s/%s.html", site.LiveURL, post.Short),
-				Title:    post.Page.Data.Title,
-			})
-		}
+// Build a set of suggestions
+func maybePages() []maybePage {
+	var maybes []maybePage
+	for _, post := range site.BlogPosts {
+		maybes = append(maybes, maybePage{
+			Location: fmt.Sprintf("%s/%s.html", site.LiveURL, post.Short),
+			Title:    post.Page.Data.Title,
+		})
+	}
+	for _, post := range site.DigitalRestorations {
+		maybes = append(maybes, maybePage{
+			Location: fmt.Sprintf("%s/%s.html", site.LiveURL, post.Short),
+			Title:    post.Page.Data.Title,
+		})
+	}
+	return maybes
+}
 
+func writeMaybePages(maybes []maybePage) withFile {
+	return func(w io.Writer) error {
 		// Template out a javascript array
 		arrBytes, err := json.Marshal(maybes)
 		if err != nil {
 			log.Err(err).
-				Str("loc", loc).
-				Msg("could not write sitemap xml")
+				Msg("could not marshal maybe pages")
 			return fmt.Errorf("could not write json array %w", err)
 		}
 		array := fmt.Sprintf("var maybe_pages = %s", string(arrBytes))
 
-		// Write it to file
-		_, err = w.WriteString(array)
+		// Write it out
+		_, err = io.WriteString(w, array)
 		if err != nil {
 			log.Err(err).
-				Str("loc", loc).
-				Msg("could not write sitemap xml")
-			return fmt.Errorf("could not write sitemap xml: %w", err)
+				Msg("could not write maybe pages")
+			return fmt.Errorf("could not write maybe pages: %w", err)
 		}
 
 		return nil
@@ -262,17 +268,63 @@ func page(p site.Page) withFile {
 	// so include them in the sitemap.
 	sitemapShorts = append(sitemapShorts, p.Short)
 
+	return hiddenPage(p)
+}
+
+// Like a page, but kept out of the sitemap.
+func hiddenPage(p site.Page) withFile {
 	return func(w io.Writer) error {
-		err := p.Template.ExecuteTemplate(w, "root", p.Data)
+		// -> Link previews need the image to be there. Cards are made with the
+		// page, so are fine.
+		if og := p.Data.OpenGraph; !og.CardGenerated() {
+			err := checkStaticImage(og.Image)
+			if err != nil {
+				log.Err(err).Str("short", p.Short).Msg("bad open graph image")
+				return err
+			}
+		}
+
+		var buf bytes.Buffer
+		err := p.Template.ExecuteTemplate(&buf, "root", p.Data)
 		if err != nil {
 			log.Err(err).
 				Msg("templating failed")
 			return err
 		}
-		return nil
+
+		// -> Links to headers on the page must still go somewhere
+		missing, err := missingOwnAnchors(buf.Bytes())
+		if err != nil {
+			log.Err(err).Str("short", p.Short).Msg("could not parse page")
+			return err
+		}
+		if len(missing) > 0 {
+			err = fmt.Errorf("page %s links to missing anchors: %s", p.Short, strings.Join(missing, ", "))
+			log.Err(err).Str("short", p.Short).Strs("anchors", missing).Msg("broken anchor links")
+			return err
+		}
+
+		_, err = w.Write(buf.Bytes())
+		return err
 	}
 }
 
+// Makes sure src (a path on the site) is an image in the static folder.
+func checkStaticImage(src string) error {
+	if !strings.HasPrefix(src, "/images/") {
+		return fmt.Errorf("image %s is not under /images/", src)
+	}
+	loc := filepath.Join(staticFolder, filepath.FromSlash(strings.TrimPrefix(src, "/")))
+	info, err := os.Stat(loc)
+	if err != nil {
+		return fmt.Errorf("image %s is not in %s: %w", src, staticFolder, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("image %s is a folder", src)
+	}
+	return nil
+}
+
 func redirect(p site.RedirectPage) withFile {
 	return func(w io.Writer) error {
 		err := p.Template.ExecuteTemplate(w, "redirect", p)
@@ -299,14 +351,18 @@ func snippet(p site.SnippetPage) withFile {
 
 type jobFn func() error
 
-func doAll(jobs ...jobFn) (err error) {
+func doAll(jobs ...jobFn) error {
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var err error
 	for i := range jobs {
 		job := jobs[i]
 		wg.Add(1)
 		go func() {
 			jErr := job()
+			mu.Lock()
 			err = errors.Join(err, jErr)
+			mu.Unlock()
 			wg.Done()
 		}()
 	}
@@ -314,8 +370,8 @@ func doAll(jobs ...jobFn) (err error) {
 	return err
 }
 
-func writeStyle(outputFolder, name, lightDark string) jobFn {
-	return func() error {
+func writeStyle(name, lightDark string) withFile {
+	return func(w io.Writer) error {
 		// We're going to want to prepend some stuff to the stylesheet
 		// to make ti work with my dark/light toggle. So write to string first.
 		var sb strings.Builder
@@ -334,24 +390,13 @@ func writeStyle(outputFolder, name, lightDark string) jobFn {
 		// Now add the light dark mode after the comment on each line
 		css = strings.ReplaceAll(css, "*/", fmt.Sprintf(`*/ :root[color-mode="%s"]`, lightDark))
 
-		// Make folder
-		err = os.MkdirAll(outputFolder, os.ModePerm)
-		if err != nil {
-			log.Err(err).
-				Str("dir", outputFolder).
-				Msg("could not make output dir, failing")
-			return err
-		}
-
 		// Now we can write it out
-		loc := filepath.Join(outputFolder, lightDark+".css")
-		err = os.WriteFile(loc, []byte(css), 0664)
+		_, err = io.WriteString(w, css)
 		if err != nil {
-			log.Err(err).Str("loc", loc).Msg("could not write stylesheet")
+			log.Err(err).Str("style", name).Msg("could not write stylesheet")
 			return err
 		}
 
-		log.Debug().Str("file", loc).Msg("generated")
 		return nil
 	}
 }
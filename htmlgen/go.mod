@@ -4,17 +4,25 @@ go 1.22.1
 
 require (
 	cloud.google.com/go v0.112.1
+	github.com/BurntSushi/toml v1.3.2
 	github.com/alecthomas/chroma/v2 v2.13.0
+	github.com/andybalholm/brotli v1.1.0
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/rs/zerolog v1.32.0
+	github.com/tdewolff/minify/v2 v2.20.37
 	github.com/yuin/goldmark v1.7.0
 	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
 	go.abhg.dev/goldmark/wikilink v0.5.0
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.25.0
+	golang.org/x/sys v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
-	golang.org/x/sys v0.17.0 // indirect
+	github.com/tdewolff/parse/v2 v2.7.15 // indirect
+	golang.org/x/text v0.16.0 // indirect
 )
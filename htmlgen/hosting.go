@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// Redirects are made as pages which refresh to where they're going (see
+// site.RedirectPages), as that works on any host. Hosts which can redirect
+// properly also get them in their own format, with a 301, along with the
+// content security policy as a header (see csp.go). Then old URLs (e.g. of
+// the blog/ folder) keep working if the site moves host.
+//
+// Some hosts read their config from the site itself. For the rest, it is
+// written beside the site, e.g. _site.Caddyfile, to be included in the
+// server's config. It is written once the site is in place, so the two go
+// out together.
+
+type hostFormat struct {
+	inSite bool
+	files  map[string]func(hostConfig) ([]byte, error) // By file name
+}
+
+var hostFormats = map[string]hostFormat{
+	// -> Can do neither, and would serve config files as pages
+	"github": {},
+	"netlify": {inSite: true, files: map[string]func(hostConfig) ([]byte, error){
+		// -> Forced, else the redirect page would be served instead
+		"_redirects": redirectsFile("301!"),
+		"_headers":   headersFile,
+	}},
+	// -> Always redirects, and doesn't understand forcing
+	"cloudflare": {inSite: true, files: map[string]func(hostConfig) ([]byte, error){
+		"_redirects": redirectsFile("301"),
+		"_headers":   headersFile,
+	}},
+	"caddy": {files: map[string]func(hostConfig) ([]byte, error){
+		"Caddyfile": caddyConfig,
+	}},
+	"nginx": {files: map[string]func(hostConfig) ([]byte, error){
+		"nginx.conf": nginxConfig,
+	}},
+	// -> Can't set headers, without a CDN in front. Can only match the start of
+	// a key, so see s3RoutingRules.
+	"s3": {files: map[string]func(hostConfig) ([]byte, error){
+		"routing-rules.json": s3RoutingRules,
+	}},
+}
+
+func hostFormatOf(host string) (hostFormat, error) {
+	format, ok := hostFormats[host]
+	if !ok {
+		err := fmt.Errorf("unknown host %q, should be one of %s", host, strings.Join(hostNames(), ", "))
+		log.Err(err).Msg("can't write config for host")
+		return hostFormat{}, err
+	}
+	return format, nil
+}
+
+func hostNames() []string {
+	var names []string
+	for name := range hostFormats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+type hostConfig struct {
+	redirects []hostRedirect
+	policy    contentPolicy
+}
+
+type hostRedirect struct {
+	from string // E.g. /blog/jira-tickets
+	to   string // URL, or path in the site
+}
+
+// Each redirect page can be got to with or without .html.
+func hostRedirects() []hostRedirect {
+	var redirects []hostRedirect
+	for _, r := range site.RedirectPages {
+		redirects = append(redirects,
+			hostRedirect{"/" + r.Short, r.Dest},
+			hostRedirect{"/" + r.Short + ".html", r.Dest},
+		)
+	}
+	return redirects
+}
+
+// Writes the config for host into siteFolder, if the host reads it from
+// there. Otherwise it is given back by file name, for writeBesideSite.
+func writeHostConfig(host string, siteFolder string, policy contentPolicy) (map[string][]byte, error) {
+	format, err := hostFormatOf(host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := hostConfig{
+		redirects: hostRedirects(),
+		policy:    policy,
+	}
+	beside := make(map[string][]byte)
+	for name, makeFile := range format.files {
+		content, err := makeFile(c)
+		if err != nil {
+			log.Err(err).Str("host", host).Str("file", name).Msg("could not make host config")
+			return nil, err
+		}
+		if !format.inSite {
+			beside[name] = content
+			continue
+		}
+
+		// -> Keep any from the static folder
+		loc := filepath.Join(siteFolder, name)
+		existing, err := os.ReadFile(loc)
+		if err == nil {
+			content = append(append(existing, '\n'), content...)
+		}
+		err = writeOutputFile(loc, content)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Str("file", loc).Msg("wrote host config")
+	}
+	return beside, nil
+}
+
+// Writes host config beside outputFolder, e.g. _site.Caddyfile.
+func writeBesideSite(outputFolder string, files map[string][]byte) error {
+	for name, content := range files {
+		loc := filepath.Clean(outputFolder) + "." + name
+		err := writeOutputFile(loc, content)
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("file", loc).Msg("wrote host config")
+	}
+	return nil
+}
+
+// Netlify and Cloudflare Pages: a rule per line.
+func redirectsFile(status string) func(hostConfig) ([]byte, error) {
+	return func(c hostConfig) ([]byte, error) {
+		var b strings.Builder
+		for _, r := range c.redirects {
+			fmt.Fprintf(&b, "%s %s %s\n", r.from, r.to, status)
+		}
+		return []byte(b.String()), nil
+	}
+}
+
+func headersFile(c hostConfig) ([]byte, error) {
+	return []byte(fmt.Sprintf("/*\n  Content-Security-Policy: %s\n", c.policy.header())), nil
+}
+
+// To be imported into the site's block.
+func caddyConfig(c hostConfig) ([]byte, error) {
+	var b strings.Builder
+	for _, r := range c.redirects {
+		fmt.Fprintf(&b, "redir %s %s permanent\n", r.from, r.to)
+	}
+	fmt.Fprintf(&b, "header Content-Security-Policy %q\n", c.policy.header())
+	return []byte(b.String()), nil
+}
+
+// To be included in the site's server block.
+func nginxConfig(c hostConfig) ([]byte, error) {
+	var b strings.Builder
+	for _, r := range c.redirects {
+		fmt.Fprintf(&b, "location = %s { return 301 %s; }\n", r.from, r.to)
+	}
+	fmt.Fprintf(&b, "add_header Content-Security-Policy %q always;\n", c.policy.header())
+	return []byte(b.String()), nil
+}
+
+// As the S3 console takes them. S3 only matches the start of a key, so rules
+// are anchored as far as they can be: on the whole key for .html URLs, and
+// only for keys which aren't there otherwise, so no page is ever taken over.
+func s3RoutingRules(c hostConfig) ([]byte, error) {
+	type condition struct {
+		KeyPrefixEquals             string
+		HttpErrorCodeReturnedEquals string `json:",omitempty"`
+	}
+	type redirect struct {
+		Protocol         string `json:",omitempty"`
+		HostName         string `json:",omitempty"`
+		ReplaceKeyWith   string
+		HttpRedirectCode string
+	}
+	type rule struct {
+		Condition condition
+		Redirect  redirect
+	}
+
+	var rules []rule
+	for _, r := range c.redirects {
+		to, err := url.Parse(r.to)
+		if err != nil {
+			return nil, err
+		}
+		cond := condition{KeyPrefixEquals: strings.TrimPrefix(r.from, "/")}
+		if !strings.HasSuffix(cond.KeyPrefixEquals, ".html") {
+			cond.HttpErrorCodeReturnedEquals = "404"
+		}
+		rules = append(rules, rule{
+			Condition: cond,
+			Redirect: redirect{
+				Protocol:         to.Scheme,
+				HostName:         to.Host,
+				ReplaceKeyWith:   strings.TrimPrefix(to.Path, "/"),
+				HttpRedirectCode: "301",
+			},
+		})
+	}
+
+	// -> Longer prefixes first, as the first rule to match wins
+	slices.SortStableFunc(rules, func(a, b rule) int {
+		return len(b.Condition.KeyPrefixEquals) - len(a.Condition.KeyPrefixEquals)
+	})
+	return json.MarshalIndent(rules, "", "  ")
+}
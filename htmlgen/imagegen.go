@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/images"
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// Every image the site uses, and every review poster, is made in several
+// widths for srcset. Images are checked against the shape they are declared
+// as, so they don't get stretched.
+
+const posterFolder = "/images/review-posters/"
+
+// Resizing takes a lot of memory, so only do so many at once.
+var imageSlots = make(chan struct{}, runtime.NumCPU())
+
+type sourceImage struct {
+	src          string
+	realWidth    int
+	displayWidth int
+}
+
+// Records the largest width of each image in assets, as what the image is
+// fingerprinted as.
+func imageJobs(b *build, assets map[string]string) ([]jobFn, error) {
+	var sources []sourceImage
+	var errs error
+
+	// -> Images in the site
+	for _, used := range site.UsedImages() {
+		source, err := checkedImage(used.Src, used.Width, used.Height)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		sources = append(sources, source)
+	}
+
+	// -> Posters
+	entries, err := os.ReadDir(images.Loc(posterFolder))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Err(err).Str("folder", posterFolder).Msg("could not read posters")
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".jpg" {
+			continue
+		}
+		source, err := checkedImage(posterFolder+entry.Name(), site.PosterWidth, site.PosterHeight)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		sources = append(sources, source)
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	// Make each width of each
+	var jobs []jobFn
+	made := make(map[string]bool)
+	for _, source := range sources {
+		hash, err := images.Hash(source.src)
+		if err != nil {
+			log.Err(err).Str("src", source.src).Msg("could not read image")
+			return nil, err
+		}
+		variants := images.Variants(source.src, hash, source.realWidth, source.displayWidth)
+		assets[source.src] = variants[len(variants)-1].Src
+		for _, v := range variants {
+			if made[v.Src] {
+				continue
+			}
+			made[v.Src] = true
+			name := strings.TrimPrefix(v.Src, "/")
+			jobs = append(jobs, b.assetJob(name, images.Version, []any{hash, v.Width}, resizeImage(source.src, name, v.Width)))
+		}
+	}
+
+	log.Debug().
+		Int("images", len(sources)).
+		Int("widths", len(jobs)).
+		Msg("found images to resize")
+	return jobs, nil
+}
+
+// Reads the size of src, and checks it against how it is declared.
+func checkedImage(src string, width, height int) (sourceImage, error) {
+	realWidth, realHeight, err := images.Size(src)
+	if err != nil {
+		log.Err(err).Str("src", src).Msg("could not read image")
+		return sourceImage{}, err
+	}
+	err = images.CheckAspect(width, height, realWidth, realHeight)
+	if err != nil {
+		log.Err(err).Str("src", src).Msg("image is the wrong shape")
+		return sourceImage{}, err
+	}
+	return sourceImage{
+		src:          src,
+		realWidth:    realWidth,
+		displayWidth: width,
+	}, nil
+}
+
+// Resized images are also kept in the user's cache folder, so that builds into
+// new folders (e.g. by check and serve) needn't make them all again. Names
+// have the hash of the source in them, so are never stale.
+var sizedCacheFolder = sync.OnceValue(func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		log.Debug().Err(err).Msg("no cache folder, resized images won't be kept")
+		return ""
+	}
+	return filepath.Join(dir, "htmlgen", "images-"+images.Version)
+})
+
+func resizeImage(src, name string, width int) withFile {
+	return func(w io.Writer) error {
+		cacheLoc := ""
+		if folder := sizedCacheFolder(); folder != "" {
+			cacheLoc = filepath.Join(folder, filepath.FromSlash(name))
+		}
+		if cached, err := os.ReadFile(cacheLoc); err == nil {
+			_, err = w.Write(cached)
+			return err
+		}
+
+		imageSlots <- struct{}{}
+		defer func() { <-imageSlots }()
+
+		var buf bytes.Buffer
+		err := images.Resize(&buf, src, width)
+		if err != nil {
+			log.Err(err).Str("src", src).Int("width", width).Msg("could not resize image")
+			return err
+		}
+		if cacheLoc != "" {
+			cacheImage(cacheLoc, buf.Bytes())
+		}
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+}
+
+// Failing to cache only makes later builds slower, so isn't an error.
+func cacheImage(loc string, b []byte) {
+	err := os.MkdirAll(filepath.Dir(loc), os.ModePerm)
+	if err != nil {
+		log.Debug().Err(err).Str("loc", loc).Msg("could not cache resized image")
+		return
+	}
+	// -> Written aside and moved in, as other builds may be reading it
+	tmp := fmt.Sprintf("%s.%d.tmp", loc, os.Getpid())
+	err = os.WriteFile(tmp, b, 0664)
+	if err == nil {
+		err = os.Rename(tmp, loc)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Debug().Err(err).Str("loc", loc).Msg("could not cache resized image")
+	}
+}
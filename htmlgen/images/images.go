@@ -0,0 +1,265 @@
+// Package images makes the resized copies of the site's images which pages
+// offer through srcset.
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Bump this when the way images are made changes, so that builds make them
+// again.
+const Version = "2"
+
+// Where the site's images are kept, as /images/...
+const StaticFolder = "static"
+
+// Where resized copies go, on the site.
+const sizedFolder = "/images/sized/"
+
+// Widths to make, where the image is bigger.
+var widths = []int{160, 320, 480, 640, 960, 1280, 1920}
+
+// Widths this close below the largest aren't worth making too.
+const widthTolerance = 0.1
+
+// How far the declared and actual shape of an image may differ.
+const aspectTolerance = 0.02
+
+type Variant struct {
+	Src   string
+	Width int
+}
+
+// How much of the hash of an image goes in the names of its variants.
+const FingerprintLength = 10
+
+// The widths of src worth making, for an image which is realWidth wide but
+// shown displayWidth wide. High density screens can use up to double. The
+// largest is last.
+//
+// Variants are named with the hash of src, so browsers can keep them forever.
+func Variants(src, hash string, realWidth, displayWidth int) []Variant {
+	largest := min(realWidth, 2*displayWidth)
+
+	var variants []Variant
+	for _, w := range widths {
+		if float64(w) >= float64(largest)*(1-widthTolerance) {
+			break
+		}
+		variants = append(variants, variant(src, hash, w))
+	}
+	return append(variants, variant(src, hash, largest))
+}
+
+func variant(src, hash string, width int) Variant {
+	ext := path.Ext(src)
+	name := strings.TrimSuffix(strings.TrimPrefix(src, "/images/"), ext)
+	return Variant{
+		Src:   fmt.Sprintf("%s%s-%d.%s%s", sizedFolder, safeName(name), width, hash[:FingerprintLength], outputExt(ext)),
+		Width: width,
+	}
+}
+
+// Srcset can't have spaces (or much else) in its URLs, so names are kept to
+// letters, digits, dashes and folders.
+func safeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '/' || r == '-' || r == '_':
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// PNGs may be transparent, so stay PNGs. Everything else becomes a JPEG.
+func outputExt(ext string) string {
+	if strings.EqualFold(ext, ".png") {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+func Srcset(variants []Variant) string {
+	var parts []string
+	for _, v := range variants {
+		parts = append(parts, fmt.Sprintf("%s %dw", v.Src, v.Width))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// The file of src (a path on the site) in the static folder.
+func Loc(src string) string {
+	return filepath.Join(StaticFolder, filepath.FromSlash(strings.TrimPrefix(src, "/")))
+}
+
+// Reads the actual size of src, upright, without decoding all of it.
+func Size(src string) (int, int, error) {
+	f, err := os.Open(Loc(src))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// -> The EXIF segment is near the start, and can't be more than 64KB
+	head := make([]byte, 1<<16)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, 0, fmt.Errorf("could not read %s: %w", src, err)
+	}
+	head = head[:n]
+
+	cfg, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), f))
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not read size of %s: %w", src, err)
+	}
+	if transposed(orientation(head)) {
+		return cfg.Height, cfg.Width, nil
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Hashes the contents of src, so that what's made from it can be kept until
+// it changes. Hashes are remembered until the file is modified.
+func Hash(src string) (string, error) {
+	loc := Loc(src)
+	info, err := os.Stat(loc)
+	if err != nil {
+		return "", err
+	}
+	key := hashKey{loc, info.Size(), info.ModTime()}
+	if hash, ok := hashes.Load(key); ok {
+		return hash.(string), nil
+	}
+
+	f, err := os.Open(loc)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	hashes.Store(key, hash)
+	return hash, nil
+}
+
+type hashKey struct {
+	loc     string
+	size    int64
+	modTime time.Time
+}
+
+var hashes sync.Map // hashKey -> string
+
+// Errors if an image declared as width x height would be stretched.
+func CheckAspect(width, height, realWidth, realHeight int) error {
+	if width <= 0 || height <= 0 || realWidth <= 0 || realHeight <= 0 {
+		return fmt.Errorf("image has no size (declared %dx%d, actually %dx%d)", width, height, realWidth, realHeight)
+	}
+	declared := float64(width) / float64(height)
+	actual := float64(realWidth) / float64(realHeight)
+	if diff := declared/actual - 1; diff > aspectTolerance || diff < -aspectTolerance {
+		return fmt.Errorf("declared as %dx%d, but is actually %dx%d", width, height, realWidth, realHeight)
+	}
+	return nil
+}
+
+// Writes src scaled to width, without any of the original's metadata. At its
+// own width, the original is written instead if it is smaller.
+func Resize(w io.Writer, src string, width int) error {
+	raw, img, err := decode(Loc(src))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = Encode(&buf, path.Ext(src), scale(img, width, 0))
+	if err != nil {
+		return err
+	}
+
+	// -> Only if it'd look the same, and is the type the name says
+	ext := strings.ToLower(path.Ext(src))
+	same := width == img.Bounds().Dx() && orientation(raw) == 1 &&
+		(ext == outputExt(ext) || ext == ".jpeg")
+	if same && len(raw) < buf.Len() {
+		_, err = w.Write(raw)
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Writes the image in the file at loc scaled to height, as a progressive JPEG.
+func Thumb(w io.Writer, loc string, height int) error {
+	_, img, err := decode(loc)
+	if err != nil {
+		return err
+	}
+	return encodeJPEG(w, scale(img, 0, height), jpegQuality)
+}
+
+// Encodes img the way a source with the extension ext is kept on the site.
+func Encode(w io.Writer, ext string, img image.Image) error {
+	if outputExt(ext) == ".png" {
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		return enc.Encode(w, img)
+	}
+	return encodeJPEG(w, img, jpegQuality)
+}
+
+// Decodes the image in the file at loc upright, along with the file.
+func decode(loc string) ([]byte, image.Image, error) {
+	raw, err := os.ReadFile(loc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decode %s: %w", loc, err)
+	}
+	return raw, upright(img, orientation(raw)), nil
+}
+
+// Scales img to width or height (whichever is given), keeping its shape.
+func scale(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	switch {
+	case width > 0:
+		height = max(1, (b.Dy()*width+b.Dx()/2)/b.Dx())
+	case height > 0:
+		width = max(1, (b.Dx()*height+b.Dy()/2)/b.Dy())
+	}
+	if width == b.Dx() && height == b.Dy() {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
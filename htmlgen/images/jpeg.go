@@ -0,0 +1,463 @@
+package images
+
+import (
+	"bufio"
+	"image"
+	"io"
+	"math"
+)
+
+// The standard library only writes baseline JPEGs, which draw in from the top
+// as they load. This writes progressive ones, which draw in blurry first and
+// sharpen. It only uses spectral selection (no successive approximation), so
+// each scan is coded much like a baseline one, with the usual tables.
+//
+// See https://www.w3.org/Graphics/JPEG/itu-t81.pdf, annexes G and K.
+
+const jpegQuality = 82
+
+// Natural (row major) index of each coefficient, in zigzag order.
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Annex K quantization tables, in zigzag order.
+var baseQuant = [2][64]int{
+	// Luminance
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	// Chrominance
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type huffmanSpec struct {
+	counts [16]byte // Number of codes of each length
+	values []byte
+}
+
+// Annex K Huffman tables: luminance DC, luminance AC, chrominance DC and
+// chrominance AC.
+var huffmanSpecs = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+type huffmanCode struct {
+	code uint32
+	size uint
+}
+
+// Canonical codes for each value, from the spec.
+func (spec huffmanSpec) codes() [256]huffmanCode {
+	var codes [256]huffmanCode
+	code := uint32(0)
+	k := 0
+	for i, count := range spec.counts {
+		for range count {
+			codes[spec.values[k]] = huffmanCode{code, uint(i + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+var huffmanCodes = func() [4][256]huffmanCode {
+	var codes [4][256]huffmanCode
+	for i, spec := range huffmanSpecs {
+		codes[i] = spec.codes()
+	}
+	return codes
+}()
+
+// A colour channel, as quantized blocks of coefficients (in zigzag order).
+type component struct {
+	id       byte
+	sampling byte // Horizontal and vertical sampling factors, as 4 bits each
+	table    int  // 0 for luminance, 1 for chrominance
+	stride   int  // Blocks per row
+	blocks   [][64]int32
+	// Blocks in each direction which have image in them, as opposed to just
+	// padding the last MCU out. Only these are in non-interleaved scans.
+	usedX, usedY int
+}
+
+func (c *component) block(x, y int) *[64]int32 {
+	return &c.blocks[y*c.stride+x]
+}
+
+// Which coefficients of which components each scan has, in order. The DC
+// scan gives a blurry image, and the low luminance frequencies sharpen it.
+var scanScript = []struct {
+	components []int
+	start, end int
+}{
+	{[]int{0, 1, 2}, 0, 0},
+	{[]int{0}, 1, 5},
+	{[]int{2}, 1, 63},
+	{[]int{1}, 1, 63},
+	{[]int{0}, 6, 63},
+}
+
+func encodeJPEG(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	quant := scaledQuant(quality)
+
+	// Split into channels, with chroma at half resolution (4:2:0)
+	mcuX, mcuY := (width+15)/16, (height+15)/16
+	planeW, planeH := mcuX*16, mcuY*16
+	yPlane := make([]float64, planeW*planeH)
+	cbPlane := make([]float64, planeW*planeH)
+	crPlane := make([]float64, planeW*planeH)
+	for y := 0; y < planeH; y++ {
+		for x := 0; x < planeW; x++ {
+			// -> Padding repeats the edges
+			r, g, bl, _ := img.At(b.Min.X+min(x, width-1), b.Min.Y+min(y, height-1)).RGBA()
+			rf, gf, bf := float64(r>>8), float64(g>>8), float64(bl>>8)
+			i := y*planeW + x
+			yPlane[i] = 0.299*rf + 0.587*gf + 0.114*bf
+			cbPlane[i] = -0.168736*rf - 0.331264*gf + 0.5*bf + 128
+			crPlane[i] = 0.5*rf - 0.418688*gf - 0.081312*bf + 128
+		}
+	}
+
+	chromaW := (width + 1) / 2
+	comps := [3]*component{
+		{id: 1, sampling: 0x22, table: 0, usedX: (width + 7) / 8, usedY: (height + 7) / 8},
+		{id: 2, sampling: 0x11, table: 1, usedX: (chromaW + 7) / 8, usedY: ((height+1)/2 + 7) / 8},
+		{id: 3, sampling: 0x11, table: 1, usedX: (chromaW + 7) / 8, usedY: ((height+1)/2 + 7) / 8},
+	}
+	comps[0].stride = mcuX * 2
+	comps[0].blocks = make([][64]int32, mcuX*2*mcuY*2)
+	for by := 0; by < mcuY*2; by++ {
+		for bx := 0; bx < mcuX*2; bx++ {
+			var samples [64]float64
+			for i := range samples {
+				samples[i] = yPlane[(by*8+i/8)*planeW+bx*8+i%8]
+			}
+			fdct(&samples, &quant[0], comps[0].block(bx, by))
+		}
+	}
+	for c, plane := range [2][]float64{cbPlane, crPlane} {
+		comp := comps[c+1]
+		comp.stride = mcuX
+		comp.blocks = make([][64]int32, mcuX*mcuY)
+		for by := 0; by < mcuY; by++ {
+			for bx := 0; bx < mcuX; bx++ {
+				var samples [64]float64
+				for i := range samples {
+					// -> Average each 2x2 of pixels
+					px, py := bx*16+(i%8)*2, by*16+(i/8)*2
+					samples[i] = (plane[py*planeW+px] + plane[py*planeW+px+1] +
+						plane[(py+1)*planeW+px] + plane[(py+1)*planeW+px+1]) / 4
+				}
+				fdct(&samples, &quant[1], comp.block(bx, by))
+			}
+		}
+	}
+
+	// Write it out
+	bw := &bitWriter{w: bufio.NewWriter(w)}
+	bw.marker(0xd8, nil) // Start of image
+	bw.marker(0xe0, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+	var dqt []byte
+	for i, table := range quant {
+		dqt = append(dqt, byte(i))
+		for _, q := range table {
+			dqt = append(dqt, byte(q))
+		}
+	}
+	bw.marker(0xdb, dqt)
+	sof := []byte{8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 3}
+	for _, c := range comps {
+		sof = append(sof, c.id, c.sampling, byte(c.table))
+	}
+	bw.marker(0xc2, sof) // Progressive
+	var dht []byte
+	for i, spec := range huffmanSpecs {
+		// -> Class (DC/AC) and destination
+		dht = append(dht, byte(i%2)<<4|byte(i/2))
+		dht = append(dht, spec.counts[:]...)
+		dht = append(dht, spec.values...)
+	}
+	bw.marker(0xc4, dht)
+
+	for _, scan := range scanScript {
+		sos := []byte{byte(len(scan.components))}
+		for _, c := range scan.components {
+			t := byte(comps[c].table)
+			sos = append(sos, comps[c].id, t<<4|t)
+		}
+		sos = append(sos, byte(scan.start), byte(scan.end), 0)
+		bw.marker(0xda, sos)
+
+		if scan.start == 0 {
+			bw.dcScan(comps, mcuX, mcuY)
+		} else {
+			bw.acScan(comps[scan.components[0]], scan.start, scan.end)
+		}
+		bw.flushBits()
+	}
+
+	bw.marker(0xd9, nil) // End of image
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+// Tables for quality (1 to 100), scaled like libjpeg does.
+func scaledQuant(quality int) [2][64]int {
+	quality = max(1, min(quality, 100))
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+
+	var quant [2][64]int
+	for t := range quant {
+		for i, q := range baseQuant[t] {
+			quant[t][i] = max(1, min((q*scale+50)/100, 255))
+		}
+	}
+	return quant
+}
+
+var dctCos = func() [8][8]float64 {
+	var c [8][8]float64
+	for u := range 8 {
+		cu := 1.0
+		if u == 0 {
+			cu = 1 / math.Sqrt2
+		}
+		for x := range 8 {
+			c[u][x] = cu / 2 * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return c
+}()
+
+// Transforms samples (row major) and quantizes them into out (zigzag order).
+func fdct(samples *[64]float64, quant *[64]int, out *[64]int32) {
+	// -> Rows, then columns
+	var rows [64]float64
+	for y := range 8 {
+		for u := range 8 {
+			var sum float64
+			for x := range 8 {
+				sum += dctCos[u][x] * (samples[y*8+x] - 128)
+			}
+			rows[y*8+u] = sum
+		}
+	}
+	var coeffs [64]float64
+	for u := range 8 {
+		for v := range 8 {
+			var sum float64
+			for y := range 8 {
+				sum += dctCos[v][y] * rows[y*8+u]
+			}
+			coeffs[v*8+u] = sum
+		}
+	}
+
+	for k, i := range zigzag {
+		out[k] = int32(math.Round(coeffs[i] / float64(quant[k])))
+	}
+}
+
+type bitWriter struct {
+	w    *bufio.Writer
+	err  error
+	bits uint32
+	n    uint // Number of bits waiting in bits
+}
+
+func (bw *bitWriter) writeByte(b byte) {
+	if bw.err == nil {
+		bw.err = bw.w.WriteByte(b)
+	}
+}
+
+func (bw *bitWriter) marker(m byte, data []byte) {
+	bw.writeByte(0xff)
+	bw.writeByte(m)
+	if data == nil {
+		return
+	}
+	n := len(data) + 2
+	bw.writeByte(byte(n >> 8))
+	bw.writeByte(byte(n))
+	for _, b := range data {
+		bw.writeByte(b)
+	}
+}
+
+func (bw *bitWriter) writeBits(bits uint32, n uint) {
+	bw.bits = bw.bits<<n | bits&(1<<n-1)
+	bw.n += n
+	for bw.n >= 8 {
+		b := byte(bw.bits >> (bw.n - 8))
+		bw.writeByte(b)
+		// -> So it isn't mistaken for a marker
+		if b == 0xff {
+			bw.writeByte(0)
+		}
+		bw.n -= 8
+	}
+}
+
+// Pads the last byte out with ones.
+func (bw *bitWriter) flushBits() {
+	if bw.n > 0 {
+		bw.writeBits(1<<(8-bw.n)-1, 8-bw.n)
+	}
+	bw.bits = 0
+}
+
+func (bw *bitWriter) huffman(table int, value byte) {
+	code := huffmanCodes[table][value]
+	bw.writeBits(code.code, code.size)
+}
+
+// Writes a Huffman coded size, and then v in that many bits.
+func (bw *bitWriter) sizedValue(table int, run int, v int32) {
+	size := uint(0)
+	for a := v; a != 0; a /= 2 {
+		size++
+	}
+	bw.huffman(table, byte(run<<4)|byte(size))
+	if v < 0 {
+		v--
+	}
+	bw.writeBits(uint32(v), size)
+}
+
+// The first scan: DC coefficients of every component, interleaved by MCU.
+func (bw *bitWriter) dcScan(comps [3]*component, mcuX, mcuY int) {
+	var pred [3]int32
+	for my := range mcuY {
+		for mx := range mcuX {
+			for c, comp := range comps {
+				h, v := int(comp.sampling>>4), int(comp.sampling&0xf)
+				for by := range v {
+					for bx := range h {
+						dc := comp.block(mx*h+bx, my*v+by)[0]
+						bw.sizedValue(comp.table*2, 0, dc-pred[c])
+						pred[c] = dc
+					}
+				}
+			}
+		}
+	}
+}
+
+// A scan of some AC coefficients of one component, block by block.
+func (bw *bitWriter) acScan(comp *component, start, end int) {
+	table := comp.table*2 + 1
+	for by := range comp.usedY {
+		for bx := range comp.usedX {
+			block := comp.block(bx, by)
+			run := 0
+			for k := start; k <= end; k++ {
+				if block[k] == 0 {
+					run++
+					continue
+				}
+				for run > 15 {
+					bw.huffman(table, 0xf0)
+					run -= 16
+				}
+				bw.sizedValue(table, run, block[k])
+				run = 0
+			}
+			if run > 0 {
+				bw.huffman(table, 0x00) // End of block
+			}
+		}
+	}
+}
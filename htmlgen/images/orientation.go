@@ -0,0 +1,122 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// Cameras save JPEGs the way the sensor was held, with an EXIF tag saying how
+// to turn them upright. Browsers follow it, but Go's decoder doesn't, so we
+// do it ourselves.
+//
+// See https://www.cipa.jp/std/documents/e/DC-008-2012_E.pdf, section 4.6.4.
+
+// The EXIF orientation of a JPEG, 1 (upright) if it doesn't say.
+func orientation(jpeg []byte) int {
+	// -> Walk the markers up to the image data, looking for the EXIF one
+	if !bytes.HasPrefix(jpeg, []byte{0xFF, 0xD8}) {
+		return 1
+	}
+	for i := 2; i+4 <= len(jpeg); {
+		if jpeg[i] != 0xFF {
+			return 1
+		}
+		marker := jpeg[i+1]
+		size := int(binary.BigEndian.Uint16(jpeg[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(jpeg) {
+			return 1
+		}
+		segment := jpeg[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// Reads the orientation tag from the first IFD of tiff.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < count; e++ {
+		entry := ifd + 2 + 12*e
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
+
+// Whether the orientation has the image on its side, so its width and height
+// are swapped.
+func transposed(o int) bool {
+	return o >= 5
+}
+
+// Turns img upright, given its orientation.
+func upright(img image.Image, o int) image.Image {
+	if o <= 1 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if transposed(o) {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// -> Where (x, y) of the stored image ends up
+			var dx, dy int
+			switch o {
+			case 2: // Mirrored
+				dx, dy = w-1-x, y
+			case 3: // Upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // Upside down and mirrored
+				dx, dy = x, h-1-y
+			case 5: // Mirrored, on its side
+				dx, dy = y, x
+			case 6: // On its side, top to the right
+				dx, dy = h-1-y, x
+			case 7: // Mirrored, on its other side
+				dx, dy = h-1-y, w-1-x
+			case 8: // On its side, top to the left
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
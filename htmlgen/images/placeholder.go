@@ -0,0 +1,68 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// How many bands (top to bottom) a placeholder blurs an image into.
+const placeholderBands = 3
+
+// Something to show while an image loads: its average colour, and the
+// average colour of each band down it, which together make a very blurry
+// copy as a CSS gradient.
+type Placeholder struct {
+	Colour string // e.g. #1a2b3c
+	Bands  []string
+}
+
+func MakePlaceholder(src string) (Placeholder, error) {
+	_, img, err := decode(Loc(src))
+	if err != nil {
+		return Placeholder{}, err
+	}
+
+	b := img.Bounds()
+	var bands []string
+	var total colourSum
+	for i := range placeholderBands {
+		band := image.Rect(b.Min.X, b.Min.Y+i*b.Dy()/placeholderBands, b.Max.X, b.Min.Y+(i+1)*b.Dy()/placeholderBands)
+		sum := sumColours(img, band)
+		bands = append(bands, sum.hex())
+		total.add(sum)
+	}
+	return Placeholder{
+		Colour: total.hex(),
+		Bands:  bands,
+	}, nil
+}
+
+type colourSum struct {
+	r, g, b, n uint64
+}
+
+func sumColours(img image.Image, rect image.Rectangle) colourSum {
+	var sum colourSum
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			sum.add(colourSum{uint64(c.R), uint64(c.G), uint64(c.B), 1})
+		}
+	}
+	return sum
+}
+
+func (s *colourSum) add(o colourSum) {
+	s.r += o.r
+	s.g += o.g
+	s.b += o.b
+	s.n += o.n
+}
+
+func (s colourSum) hex() string {
+	if s.n == 0 {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", s.r/s.n, s.g/s.n, s.b/s.n)
+}
@@ -2,7 +2,9 @@ package letterboxd
 
 import (
 	"archive/zip"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -63,6 +65,34 @@ func ReadExport() (UserData, error) {
 	}, nil
 }
 
+// Identifies the export ReadExport would read, so that callers can tell if it
+// has changed.
+func ExportFingerprint() (string, error) {
+	zipPath, err := pickZip()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(zipPath)
+	if err != nil {
+		log.Err(err).
+			Str("zip", zipPath).
+			Msg("could not open letterboxd zip")
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		log.Err(err).
+			Str("zip", zipPath).
+			Msg("could not read letterboxd zip")
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 var exportZipRegex = regexp.MustCompile(`^letterboxd-.*\.zip$`)
 
 func pickZip() (string, error) {
@@ -0,0 +1,186 @@
+// Package linkrot checks that external links still work.
+package linkrot
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/parallel"
+	"github.com/liampulles/liampulles.github.io/htmlgen/repo"
+	"github.com/rs/zerolog/log"
+)
+
+type Checker struct {
+	Client      *http.Client
+	Concurrency int           // How many links to check at once.
+	HostDelay   time.Duration // How long to wait between requests to the same host.
+	TTL         time.Duration // How long a cached result is good for.
+	Cache       Cache
+}
+
+// Where results are kept between runs.
+type Cache interface {
+	Get(url string) (repo.LinkCheck, bool)
+	Put(url string, check repo.LinkCheck)
+}
+
+type Result struct {
+	URL string
+	repo.LinkCheck
+}
+
+func (r Result) Dead() bool {
+	return r.Status == 0 || r.Status >= 400
+}
+
+func (r Result) Redirected() bool {
+	return !r.Dead() && r.Location != "" && r.Location != r.URL
+}
+
+// Sensible defaults, with results cached in the repo.
+func NewChecker() *Checker {
+	return &Checker{
+		Client: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+		Concurrency: 8,
+		HostDelay:   time.Second,
+		TTL:         7 * 24 * time.Hour,
+		Cache:       repoCache{},
+	}
+}
+
+// Checks each of the urls, using cached results where they're fresh enough.
+// Results are sorted by URL.
+func (c *Checker) Check(ctx context.Context, urls []string) []Result {
+	limiter := newHostLimiter(c.HostDelay)
+
+	var results []Result
+	var mu sync.Mutex
+	var jobs []parallel.Job
+	for _, u := range urls {
+		jobs = append(jobs, func() error {
+			check, ok := c.cached(u)
+			if !ok {
+				check = c.check(ctx, limiter, u)
+				// -> Requests which failed outright may be our fault (e.g. offline),
+				// so always try them again.
+				if c.Cache != nil && check.Status != 0 {
+					c.Cache.Put(u, check)
+				}
+			}
+
+			mu.Lock()
+			results = append(results, Result{URL: u, LinkCheck: check})
+			mu.Unlock()
+			return nil
+		})
+	}
+	parallel.Concurrent(jobs, max(c.Concurrency, 1))
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].URL < results[j].URL
+	})
+	return results
+}
+
+func (c *Checker) cached(u string) (repo.LinkCheck, bool) {
+	if c.Cache == nil {
+		return repo.LinkCheck{}, false
+	}
+	check, ok := c.Cache.Get(u)
+	if !ok || time.Since(check.CheckedAt) > c.TTL {
+		return repo.LinkCheck{}, false
+	}
+	return check, true
+}
+
+func (c *Checker) check(ctx context.Context, limiter *hostLimiter, u string) repo.LinkCheck {
+	check := repo.LinkCheck{CheckedAt: time.Now()}
+
+	// -> Try a HEAD first, as it is cheap. Some servers don't like them though,
+	// so try again with a GET if it didn't work. Both wait their turn.
+	limiter.wait(ctx, u)
+	resp, err := c.do(ctx, http.MethodHead, u)
+	if err != nil || resp.StatusCode >= 400 {
+		limiter.wait(ctx, u)
+		resp, err = c.do(ctx, http.MethodGet, u)
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("url", u).Msg("link check failed")
+		check.Error = err.Error()
+		return check
+	}
+
+	check.Status = resp.StatusCode
+	if final := resp.Request.URL.String(); final != u {
+		check.Location = final
+	}
+	return check
+}
+
+func (c *Checker) do(ctx context.Context, method, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "htmlgen-linkrot (+https://liampulles.com)")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// Spaces out requests to each host.
+type hostLimiter struct {
+	delay time.Duration
+
+	mu   sync.Mutex // Guards the below
+	next map[string]time.Time
+}
+
+func newHostLimiter(delay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		delay: delay,
+		next:  make(map[string]time.Time),
+	}
+}
+
+// Blocks until it is u's host's turn.
+func (l *hostLimiter) wait(ctx context.Context, u string) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return
+	}
+
+	// -> Book the next slot for this host
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[parsed.Host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[parsed.Host] = at.Add(l.delay)
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(at)):
+	case <-ctx.Done():
+	}
+}
+
+type repoCache struct{}
+
+func (repoCache) Get(url string) (repo.LinkCheck, bool) {
+	return repo.GetLinkCheck(url)
+}
+
+func (repoCache) Put(url string, check repo.LinkCheck) {
+	repo.UpsertLinkCheck(url, check)
+}
@@ -0,0 +1,97 @@
+package linkrot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/missing":
+			http.NotFound(w, r)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c := NewChecker()
+	c.Client = srv.Client()
+	c.HostDelay = 0
+	c.Cache = nil
+
+	results := c.Check(context.Background(), []string{
+		srv.URL + "/ok",
+		srv.URL + "/missing",
+		srv.URL + "/moved",
+		srv.URL + "/no-head",
+	})
+
+	want := map[string]struct {
+		status     int
+		dead       bool
+		redirected bool
+	}{
+		srv.URL + "/ok":      {200, false, false},
+		srv.URL + "/missing": {404, true, false},
+		srv.URL + "/moved":   {200, false, true},
+		srv.URL + "/no-head": {200, false, false},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, r := range results {
+		w := want[r.URL]
+		if r.Status != w.status || r.Dead() != w.dead || r.Redirected() != w.redirected {
+			t.Errorf("%s: got status %d, dead %v, redirected %v; want %d, %v, %v",
+				r.URL, r.Status, r.Dead(), r.Redirected(), w.status, w.dead, w.redirected)
+		}
+		if w.redirected && r.Location != srv.URL+"/ok" {
+			t.Errorf("%s: got location %q, want %q", r.URL, r.Location, srv.URL+"/ok")
+		}
+	}
+}
+
+// The GET after a rejected HEAD is a request like any other, so mustn't come
+// sooner than the host delay.
+func TestCheckSpacesOutGetAfterHead(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	var mu sync.Mutex
+	var at []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		at = append(at, time.Now())
+		mu.Unlock()
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewChecker()
+	c.Client = srv.Client()
+	c.HostDelay = delay
+	c.Cache = nil
+
+	results := c.Check(context.Background(), []string{srv.URL + "/no-head"})
+	if results[0].Status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", results[0].Status)
+	}
+	if len(at) != 2 {
+		t.Fatalf("got %d requests, want 2", len(at))
+	}
+	if gap := at[1].Sub(at[0]); gap < delay {
+		t.Errorf("GET came %v after HEAD, want at least %v", gap, delay)
+	}
+}
@@ -23,6 +23,17 @@ func init() {
 //   in markdownish.
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			err := cmd(os.Args[2:])
+			if err != nil {
+				os.Exit(2)
+			}
+			return
+		}
+	}
+
 	// Measure time
 	start := time.Now()
 	defer func() {
@@ -33,7 +44,8 @@ func main() {
 
 	// Parse flags
 	fs := flag.NewFlagSet("htmlgen", flag.ContinueOnError)
-	outputFlag := fs.String("output", "_site_gen", "folder to render the outputted \"site\" to")
+	cfg := genConfigFlags(fs)
+	fs.StringVar(&cfg.OutputFolder, "output", "_site_gen", "folder to render the outputted \"site\" to")
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		log.Err(err).Msg("arg parse fail")
 		os.Exit(1)
@@ -41,12 +53,27 @@ func main() {
 
 	// Run the program
 	// Generate the site
-	err := GenSite(*outputFlag)
+	err := GenSite(*cfg)
 	if err != nil {
 		os.Exit(2)
 	}
 
 	log.Info().
-		Str("output_folder", *outputFlag).
+		Str("output_folder", cfg.OutputFolder).
 		Msg("site generated!")
 }
+
+var subcommands = map[string]func(args []string) error{
+	"build": Build,
+	"serve": Serve,
+	"check": Check,
+	"thumb": Thumb,
+}
+
+// Flags for anything which generates the site.
+func genConfigFlags(fs *flag.FlagSet) *GenConfig {
+	var cfg GenConfig
+	fs.StringVar(&cfg.ContentFolder, "content", "content/blog", "folder of markdown blog posts to include")
+	fs.BoolVar(&cfg.Drafts, "drafts", false, "also render drafts under /drafts/, for previewing")
+	return &cfg
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// Builds are incremental. We keep a manifest in the output folder which
+// records, for each file we output, a hash of what it was made from and a
+// hash of what was written. Next time round:
+// - If a file's inputs haven't changed, we don't bother making it again.
+// - If they have, but the output comes out the same, we don't rewrite it.
+// - Files from the last build which we no longer output get deleted.
+//
+// Inputs are hashed along with the generator (htmlgen and its templates), so
+// any code change means everything is made again. Assets which are slow to
+// make (e.g. resized images) are instead hashed along with a version, which is
+// bumped when the way they are made changes.
+
+const manifestFile = ".htmlgen-manifest.json"
+
+type manifest struct {
+	Files map[string]manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Inputs string `json:"inputs"`
+	Output string `json:"output"`
+	Size   int64  `json:"size"`
+}
+
+type build struct {
+	outputFolder  string
+	stagingFolder string // Where this build is written, see stage.go
+	prev          manifest
+
+	assets string // Hash of the names of assets, which pages link to
+
+	mu                        sync.Mutex // Guards the below
+	next                      manifest
+	skipped, unchanged, wrote int
+}
+
+// Reads the manifest of the last build, and stages the output folder. If there
+// isn't a manifest, we can't know what is in the output folder, so we start
+// fresh.
+func newBuild(outputFolder string) (*build, error) {
+	b := &build{
+		outputFolder: outputFolder,
+		prev:         manifest{Files: make(map[string]manifestEntry)},
+		next:         manifest{Files: make(map[string]manifestEntry)},
+	}
+
+	loc := filepath.Join(outputFolder, manifestFile)
+	raw, err := os.ReadFile(loc)
+	if err == nil {
+		err = json.Unmarshal(raw, &b.prev)
+	}
+	fresh := err != nil || b.prev.Files == nil
+	if fresh {
+		log.Debug().Err(err).Str("loc", loc).Msg("no usable build manifest, starting fresh")
+		b.prev.Files = make(map[string]manifestEntry)
+	}
+
+	b.stagingFolder, err = stageOutput(outputFolder, fresh)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *build) genJob(short string, inputs any, with withFile) jobFn {
+	return b.fileJob(short+".html", inputs, with)
+}
+
+// Makes the file name in the output folder, if inputs have changed.
+func (b *build) fileJob(name string, inputs any, with withFile) jobFn {
+	return b.hashedJob(name, func() string {
+		gen, err := generatorHash()
+		if err != nil {
+			return ""
+		}
+		return hashInputs(gen+"\n"+b.assets, name, inputs)
+	}, with)
+}
+
+// Pages must be made again if the assets they link to are renamed.
+func (b *build) setAssets(assets map[string]string) {
+	b.assets = hashInputs("", "assets", assets)
+}
+
+// Like fileJob, but kept across changes to htmlgen unless version changes.
+func (b *build) assetJob(name string, version string, inputs any, with withFile) jobFn {
+	return b.hashedJob(name, func() string {
+		return hashInputs("asset "+version, name, inputs)
+	}, with)
+}
+
+func (b *build) hashedJob(name string, hash func() string, with withFile) jobFn {
+	return func() error {
+		loc := path.Join(b.stagingFolder, name)
+		inputsHash := hash()
+
+		// Can we skip it?
+		prev, ok := b.prev.Files[name]
+		if ok && inputsHash != "" && prev.Inputs == inputsHash && sizeIs(loc, prev.Size) {
+			b.record(name, prev, &b.skipped)
+			return nil
+		}
+
+		// Make it
+		var buf bytes.Buffer
+		err := with(&buf)
+		if err != nil {
+			return err
+		}
+		entry := manifestEntry{
+			Inputs: inputsHash,
+			Output: hashBytes(buf.Bytes()),
+			Size:   int64(buf.Len()),
+		}
+
+		// Only write if it is actually different
+		existing, err := os.ReadFile(loc)
+		if err == nil && bytes.Equal(existing, buf.Bytes()) {
+			b.record(name, entry, &b.unchanged)
+			return nil
+		}
+		err = writeOutputFile(loc, buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		b.record(name, entry, &b.wrote)
+		log.Debug().Str("file", loc).Msg("generated")
+		return nil
+	}
+}
+
+func (b *build) record(name string, entry manifestEntry, counter *int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next.Files[name] = entry
+	*counter++
+}
+
+// Tidies up after the jobs are done (with jobsErr). The build only replaces
+// the output folder if every job succeeded, otherwise the last one is kept.
+func (b *build) finish(jobsErr error) error {
+	if jobsErr != nil {
+		log.Warn().
+			Str("output_folder", b.outputFolder).
+			Msg("build failed, keeping the last good build")
+		return errors.Join(jobsErr, deleteFolder(b.stagingFolder))
+	}
+
+	// Delete orphans
+	for name := range b.prev.Files {
+		if _, ok := b.next.Files[name]; ok {
+			continue
+		}
+		loc := filepath.Join(b.stagingFolder, name)
+		err := os.Remove(loc)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("loc", loc).Msg("could not delete orphaned output")
+			return err
+		}
+		log.Debug().Str("file", loc).Msg("deleted orphan")
+	}
+
+	// Save the manifest
+	raw, err := json.MarshalIndent(b.next, "", "  ")
+	if err != nil {
+		log.Err(err).Msg("could not marshal build manifest")
+		return err
+	}
+	err = writeOutputFile(filepath.Join(b.stagingFolder, manifestFile), raw)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().
+		Int("skipped", b.skipped).
+		Int("unchanged", b.unchanged).
+		Int("wrote", b.wrote).
+		Msg("build summary")
+	return swapOutput(b.stagingFolder, b.outputFolder)
+}
+
+func writeOutputFile(loc string, b []byte) error {
+	// Make folder
+	dir := filepath.Dir(loc)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		log.Err(err).
+			Str("dir", dir).
+			Msg("could not make output dir, failing")
+		return err
+	}
+
+	// -> Replace rather than write over, as the file may be linked to the
+	// last build.
+	err = os.Remove(loc)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(loc, b, 0664)
+	}
+	if err != nil {
+		log.Err(err).
+			Str("loc", loc).
+			Msg("could not write output file, failing")
+		return err
+	}
+	return nil
+}
+
+func sizeIs(loc string, size int64) bool {
+	info, err := os.Stat(loc)
+	return err == nil && info.Size() == size
+}
+
+// An empty result means the inputs can't be hashed, so must always be redone.
+func hashInputs(gen string, name string, inputs any) string {
+	raw, err := json.Marshal(inputs)
+	if err != nil {
+		log.Debug().Err(err).Str("name", name).Msg("could not hash inputs")
+		return ""
+	}
+
+	h := sha256.New()
+	io.WriteString(h, gen)
+	io.WriteString(h, "\n"+name+"\n")
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Identifies this htmlgen: the program itself, and the templates it loaded.
+var generatorHash = sync.OnceValues(func() (string, error) {
+	h := sha256.New()
+
+	exe, err := os.Executable()
+	if err == nil {
+		var f *os.File
+		f, err = os.Open(exe)
+		if err == nil {
+			_, err = io.Copy(h, f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("could not hash htmlgen, builds won't be incremental")
+		return "", err
+	}
+
+	templates, err := filepath.Glob(filepath.Join(htmlgenFolder, "site", "*.html"))
+	if err != nil {
+		return "", err
+	}
+	for _, t := range templates {
+		raw, err := os.ReadFile(t)
+		if err != nil {
+			log.Warn().Err(err).Str("file", t).Msg("could not hash template, builds won't be incremental")
+			return "", err
+		}
+		h.Write(raw)
+	}
+
+	// Pages include the year in the footer
+	io.WriteString(h, strconv.Itoa(time.Now().Year()))
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+})
+
+// Posts hold their template, which we don't want to hash, so just take the
+// data.
+func postsInputs(posts []site.DatedPost) any {
+	type postInputs struct {
+		Data site.Root
+		Date time.Time
+	}
+	var inputs []postInputs
+	for _, post := range posts {
+		inputs = append(inputs, postInputs{
+			Data: post.Data,
+			Date: post.Date,
+		})
+	}
+	return inputs
+}
+
+// Likewise for snippets.
+func snippetsInputs(snippets []site.SnippetPage) any {
+	var inputs []site.SnippetPage
+	for _, s := range snippets {
+		s.Template = nil
+		inputs = append(inputs, s)
+	}
+	return inputs
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Pages without an image of their own get a generated card for link previews:
+// the title, the site name, and the date if there is one. The colours are
+// the dark mode ones from style.css.
+
+const (
+	ogCardWidth    = 1200
+	ogCardHeight   = 630
+	ogCardMargin   = 80
+	ogAccentBar    = 16
+	ogTitleLines   = 4
+	ogTitleSpacing = 1.2 // Of the font size
+	ogDetailsSize  = 34
+)
+
+var (
+	ogBackground  = color.RGBA{0x14, 0x18, 0x1c, 0xff} // --background
+	ogHeader      = color.RGBA{0xea, 0xeb, 0xee, 0xff} // --header
+	ogText        = color.RGBA{0xd1, 0xd5, 0xdb, 0xff} // --text
+	ogAccent      = color.RGBA{0x6d, 0x8f, 0xff, 0xff} // --link
+	ogSpecialLink = color.RGBA{0xcc, 0x00, 0x00, 0xff} // --special-link
+	// Biggest that fits within ogTitleLines is used.
+	ogTitleSizes = []float64{76, 64, 54, 46}
+)
+
+var ogFonts = sync.OnceValues(func() (map[string]*opentype.Font, error) {
+	fonts := make(map[string]*opentype.Font)
+	for name, ttf := range map[string][]byte{
+		"bold":    gobold.TTF,
+		"regular": goregular.TTF,
+	} {
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s font: %w", name, err)
+		}
+		fonts[name] = f
+	}
+	return fonts, nil
+})
+
+func ogCardFile(p site.Page) string {
+	return strings.TrimPrefix(p.Data.OpenGraph.Image, "/")
+}
+
+// Makes cards for any of the pages that need one.
+func ogCardJobs(b *build, pages ...site.Page) []jobFn {
+	var jobs []jobFn
+	for _, p := range pages {
+		og := p.Data.OpenGraph
+		if !og.CardGenerated() {
+			continue
+		}
+		jobs = append(jobs, b.fileJob(ogCardFile(p), og.Card, writeOGCard(og.Card)))
+	}
+	return jobs
+}
+
+func writeOGCard(card site.OGCard) withFile {
+	return func(w io.Writer) error {
+		img, err := drawOGCard(card)
+		if err != nil {
+			log.Err(err).Str("title", card.Title).Msg("could not draw card")
+			return err
+		}
+
+		err = png.Encode(w, img)
+		if err != nil {
+			log.Err(err).Str("title", card.Title).Msg("could not encode card")
+			return err
+		}
+		return nil
+	}
+}
+
+func drawOGCard(card site.OGCard) (image.Image, error) {
+	fonts, err := ogFonts()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, ogCardWidth, ogCardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(ogBackground), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, ogAccentBar, ogCardHeight), image.NewUniform(ogAccent), image.Point{}, draw.Src)
+
+	// -> Title, as big as will fit
+	textWidth := ogCardWidth - 2*ogCardMargin
+	var size float64
+	var lines []string
+	for _, size = range ogTitleSizes {
+		face, err := ogFace(fonts["bold"], size)
+		if err != nil {
+			return nil, err
+		}
+		lines = wrapText(face, card.Title, textWidth)
+		if len(lines) <= ogTitleLines {
+			break
+		}
+	}
+	if len(lines) > ogTitleLines {
+		lines = lines[:ogTitleLines]
+		lines[ogTitleLines-1] += "…"
+	}
+	face, err := ogFace(fonts["bold"], size)
+	if err != nil {
+		return nil, err
+	}
+	y := ogCardMargin + size
+	for _, line := range lines {
+		drawText(img, face, ogHeader, ogCardMargin, int(y), line)
+		y += size * ogTitleSpacing
+	}
+
+	// -> Site name and date, along the bottom
+	bold, err := ogFace(fonts["bold"], ogDetailsSize)
+	if err != nil {
+		return nil, err
+	}
+	regular, err := ogFace(fonts["regular"], ogDetailsSize)
+	if err != nil {
+		return nil, err
+	}
+	bottom := ogCardHeight - ogCardMargin
+	drawText(img, bold, ogSpecialLink, ogCardMargin, bottom, "Liam Pulles")
+	if !card.Date.IsZero() {
+		date := card.Date.Format("2 January 2006")
+		width := font.MeasureString(regular, date).Ceil()
+		drawText(img, regular, ogText, ogCardWidth-ogCardMargin-width, bottom, date)
+	}
+	return img, nil
+}
+
+func ogFace(f *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// Breaks text into lines no wider than width, where it can.
+func wrapText(face font.Face, text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		next := word
+		if line != "" {
+			next = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, next).Ceil() > width {
+			lines = append(lines, line)
+			next = word
+		}
+		line = next
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Draws text with its baseline at y.
+func drawText(img draw.Image, face font.Face, c color.Color, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
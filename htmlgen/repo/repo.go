@@ -4,17 +4,18 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog/log"
 )
 
-var db *sql.DB
-
-func init() {
+// The cache db is opened (and made, if need be) on first use, rather than on
+// import, so that e.g. tests which import this don't leave one lying about.
+var conn = sync.OnceValue(func() *sql.DB {
 	// Open
-	var err error
-	db, err = sql.Open("sqlite3", "./cache.sqlite")
+	db, err := sql.Open("sqlite3", "./cache.sqlite")
 	if err != nil {
 		log.Fatal().Err(err).
 			Str("location", "./cache.sqlite").
@@ -34,6 +35,14 @@ func init() {
 CREATE TABLE IF NOT EXISTS letterboxd(
 	review_uri TEXT NOT NULL PRIMARY KEY,
 	data JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS link_check(
+	url TEXT NOT NULL PRIMARY KEY,
+	data JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS image_placeholder(
+	hash TEXT NOT NULL PRIMARY KEY,
+	data JSONB NOT NULL
 )`
 
 	_, err = db.Exec(sql)
@@ -44,7 +53,8 @@ CREATE TABLE IF NOT EXISTS letterboxd(
 	}
 
 	log.Debug().Msg("opened cache db")
-}
+	return db
+})
 
 type LetterboxdInfo struct {
 	TMDBid int `json:"tmdb_id"`
@@ -54,7 +64,7 @@ func GetLetterboxdInfo(letterboxdURI string) (LetterboxdInfo, bool) {
 	var j string
 	query := `
 SELECT data FROM letterboxd WHERE review_uri = $1`
-	err := db.QueryRow(query, letterboxdURI).Scan(&j)
+	err := conn().QueryRow(query, letterboxdURI).Scan(&j)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return LetterboxdInfo{}, false
@@ -85,7 +95,108 @@ func InsertLetterboxdInfo(letterboxdURI string, info LetterboxdInfo) {
 
 	query := `
 INSERT INTO letterboxd VALUES ($1,$2)`
-	_, err = db.Exec(query, letterboxdURI, string(j))
+	_, err = conn().Exec(query, letterboxdURI, string(j))
+	if err != nil {
+		log.Fatal().Err(err).
+			Str("query", query).
+			Msg("unexpected sqlite fail")
+	}
+}
+
+type LinkCheck struct {
+	Status    int       `json:"status"`             // Last HTTP status, 0 if the request failed.
+	Location  string    `json:"location,omitempty"` // Where the URL ended up, if redirected.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func GetLinkCheck(url string) (LinkCheck, bool) {
+	var j string
+	query := `
+SELECT data FROM link_check WHERE url = $1`
+	err := conn().QueryRow(query, url).Scan(&j)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LinkCheck{}, false
+		}
+		log.Fatal().Err(err).
+			Str("query", query).
+			Msg("unexpected sqlite fail")
+	}
+
+	var check LinkCheck
+	err = json.Unmarshal([]byte(j), &check)
+	if err != nil {
+		log.Fatal().Err(err).
+			Str("check", j).
+			Msg("could not unmarshal link check")
+	}
+
+	return check, true
+}
+
+func UpsertLinkCheck(url string, check LinkCheck) {
+	j, err := json.Marshal(check)
+	if err != nil {
+		log.Fatal().Err(err).
+			Interface("check", check).
+			Msg("couldn't marshal link check")
+	}
+
+	query := `
+INSERT INTO link_check VALUES ($1,$2)
+ON CONFLICT(url) DO UPDATE SET data = excluded.data`
+	_, err = conn().Exec(query, url, string(j))
+	if err != nil {
+		log.Fatal().Err(err).
+			Str("query", query).
+			Msg("unexpected sqlite fail")
+	}
+}
+
+type ImagePlaceholder struct {
+	Colour string   `json:"colour"`
+	Bands  []string `json:"bands"`
+}
+
+// Placeholders are kept by the hash of the image they're for.
+func GetImagePlaceholder(hash string) (ImagePlaceholder, bool) {
+	var j string
+	query := `
+SELECT data FROM image_placeholder WHERE hash = $1`
+	err := conn().QueryRow(query, hash).Scan(&j)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ImagePlaceholder{}, false
+		}
+		log.Fatal().Err(err).
+			Str("query", query).
+			Msg("unexpected sqlite fail")
+	}
+
+	var placeholder ImagePlaceholder
+	err = json.Unmarshal([]byte(j), &placeholder)
+	if err != nil {
+		log.Fatal().Err(err).
+			Str("placeholder", j).
+			Msg("could not unmarshal image placeholder")
+	}
+
+	return placeholder, true
+}
+
+func UpsertImagePlaceholder(hash string, placeholder ImagePlaceholder) {
+	j, err := json.Marshal(placeholder)
+	if err != nil {
+		log.Fatal().Err(err).
+			Interface("placeholder", placeholder).
+			Msg("couldn't marshal image placeholder")
+	}
+
+	query := `
+INSERT INTO image_placeholder VALUES ($1,$2)
+ON CONFLICT(hash) DO UPDATE SET data = excluded.data`
+	_, err = conn().Exec(query, hash, string(j))
 	if err != nil {
 		log.Fatal().Err(err).
 			Str("query", query).
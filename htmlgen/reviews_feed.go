@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// The film reviews get their own feeds, since they're far more frequent than
+// blog posts. We offer Atom and JSON Feed.
+
+const (
+	reviewsFeedTitle       = "Liam Pulles's film reviews"
+	reviewsFeedDescription = "Film reviews written by Liam Pulles, from Letterboxd."
+	reviewsFeedLimit       = 50
+)
+
+type reviewFeedEntry struct {
+	site.Review
+	ID      string
+	URL     string
+	Title   string
+	Content string
+}
+
+func reviewFeedEntries() ([]reviewFeedEntry, error) {
+	reviews, err := site.Reviews()
+	if err != nil {
+		log.Err(err).Msg("could not read reviews for feed")
+		return nil, err
+	}
+	if len(reviews) > reviewsFeedLimit {
+		reviews = reviews[:reviewsFeedLimit]
+	}
+
+	var entries []reviewFeedEntry
+	for _, review := range reviews {
+		entries = append(entries, reviewFeedEntry{
+			Review:  review,
+			ID:      reviewEntryID(review.LetterboxdURI),
+			URL:     fmt.Sprintf("%s/reviews.html#%s", site.LiveURL, review.Anchor),
+			Title:   fmt.Sprintf("%s (%d) %s", review.Name, review.Year, review.StarsText),
+			Content: absoluteLinks(string(site.ReviewFeedContent(review))),
+		})
+	}
+	return entries, nil
+}
+
+// Letterboxd URIs don't change, so IDs based on them are stable across
+// rebuilds (and readers won't see duplicates).
+func reviewEntryID(letterboxdURI string) string {
+	u, err := url.Parse(letterboxdURI)
+	if err != nil || u.Host == "" {
+		return letterboxdURI
+	}
+	domain := strings.TrimPrefix(site.LiveURL, "https://")
+	return fmt.Sprintf("tag:%s,2024:reviews/%s%s", domain, u.Host, u.Path)
+}
+
+func reviewsUpdated(entries []reviewFeedEntry) time.Time {
+	var updated time.Time
+	for _, entry := range entries {
+		if entry.DateReviewed.After(updated) {
+			updated = entry.DateReviewed
+		}
+	}
+	return updated
+}
+
+func reviewsAtomFeed() withFile {
+	return func(w io.Writer) error {
+		entries, err := reviewFeedEntries()
+		if err != nil {
+			return err
+		}
+
+		feed := atomFeedXML{
+			Title:    reviewsFeedTitle,
+			Subtitle: reviewsFeedDescription,
+			Links: []atomLinkXML{
+				{Href: site.LiveURL + "/reviews.xml", Rel: "self", Type: "application/atom+xml"},
+				{Href: site.LiveURL + "/reviews.html", Rel: "alternate", Type: "text/html"},
+			},
+			ID:      site.LiveURL + "/reviews.html",
+			Updated: reviewsUpdated(entries).Format(time.RFC3339),
+			Author: atomAuthorXML{
+				Name: feedAuthor,
+				URI:  site.LiveURL + "/biography.html",
+			},
+		}
+		for _, entry := range entries {
+			feed.Entries = append(feed.Entries, atomEntryXML{
+				Title: entry.Title,
+				Links: []atomLinkXML{
+					{Href: entry.URL, Rel: "alternate", Type: "text/html"},
+					{Href: entry.LetterboxdURI, Rel: "related", Type: "text/html"},
+				},
+				ID:        entry.ID,
+				Published: entry.DateReviewed.Format(time.RFC3339),
+				Updated:   entry.DateReviewed.Format(time.RFC3339),
+				Content: atomContentXML{
+					Type: "html",
+					Body: entry.Content,
+				},
+			})
+		}
+
+		return writeXML(w, feed)
+	}
+}
+
+// See https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	ExternalURL   string `json:"external_url,omitempty"`
+	Title         string `json:"title"`
+	ContentHTML   string `json:"content_html"`
+	Image         string `json:"image,omitempty"`
+	DatePublished string `json:"date_published"`
+}
+
+func reviewsJSONFeed() withFile {
+	return func(w io.Writer) error {
+		entries, err := reviewFeedEntries()
+		if err != nil {
+			return err
+		}
+
+		feed := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       reviewsFeedTitle,
+			Description: reviewsFeedDescription,
+			HomePageURL: site.LiveURL + "/reviews.html",
+			FeedURL:     site.LiveURL + "/reviews.json",
+			Authors: []jsonFeedAuthor{
+				{Name: feedAuthor, URL: site.LiveURL + "/biography.html"},
+			},
+			Items: []jsonFeedItem{},
+		}
+		for _, entry := range entries {
+			feed.Items = append(feed.Items, jsonFeedItem{
+				ID:            entry.ID,
+				URL:           entry.URL,
+				ExternalURL:   entry.LetterboxdURI,
+				Title:         entry.Title,
+				ContentHTML:   entry.Content,
+				Image:         site.LiveURL + entry.PosterHref,
+				DatePublished: entry.DateReviewed.Format(time.RFC3339),
+			})
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(feed)
+		if err != nil {
+			log.Err(err).Msg("could not write json feed")
+			return fmt.Errorf("could not write json feed: %w", err)
+		}
+		return nil
+	}
+}
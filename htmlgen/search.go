@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// The search page is done in the browser, using an inverted index we make
+// here: stemmed terms, pointing to the pages (and sections of them) they're
+// in. The browser has to stem queries in the same way, so stem must be kept
+// in sync with script.js.
+
+const searchIndexFile = "search_index.json"
+
+// Titles count for more than body text.
+const searchTitleWeight = 5
+
+type searchIndex struct {
+	Docs []searchDoc `json:"docs"`
+	// Stemmed term -> flat list of (doc, section, count) triples. Section is
+	// an index into the doc's headers, or -1 if before any header.
+	Terms map[string][]int `json:"terms"`
+}
+
+type searchDoc struct {
+	URL     string   `json:"u"`
+	Title   string   `json:"t"`
+	Kind    string   `json:"k"`
+	Snippet bool     `json:"s,omitempty"` // Loaded into the page, rather than visited.
+	Headers []string `json:"h,omitempty"`
+	Anchors []string `json:"a,omitempty"` // Of the headers
+}
+
+// Something to be indexed, before it is broken up.
+type searchSource struct {
+	searchDoc
+	HTML string
+}
+
+type searchPostKind struct {
+	name  string
+	posts []site.DatedPost
+}
+
+// Posts to index, which the index must be made again for if they change.
+func searchPostKinds() []searchPostKind {
+	return []searchPostKind{
+		{"Blog post", listedPosts(site.BlogPosts)},
+		{"Digital restoration", listedPosts(site.DigitalRestorations)},
+	}
+}
+
+func searchSources() ([]searchSource, error) {
+	var sources []searchSource
+
+	// -> Posts
+	for _, kind := range searchPostKinds() {
+		rendered, err := renderFeedPosts(kind.posts)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range rendered {
+			sources = append(sources, searchSource{
+				searchDoc: searchDoc{
+					URL:   "/" + post.Short + ".html",
+					Title: post.Data.Title,
+					Kind:  kind.name,
+				},
+				HTML: post.Content,
+			})
+		}
+	}
+
+	// -> Snippets
+	for _, s := range site.Snippets {
+		sources = append(sources, searchSource{
+			searchDoc: searchDoc{
+				URL:     "/snippet/" + s.Short + ".html",
+				Title:   s.Header,
+				Kind:    "Snippet",
+				Snippet: true,
+			},
+			HTML: string(s.Content),
+		})
+	}
+
+	// -> Reviews
+	reviews, err := site.Reviews()
+	if err != nil {
+		log.Err(err).Msg("could not read reviews for search index")
+		return nil, err
+	}
+	for _, review := range reviews {
+		sources = append(sources, searchSource{
+			searchDoc: searchDoc{
+				URL:   "/" + site.ReviewsShort + ".html#" + review.Anchor,
+				Title: fmt.Sprintf("%s (%d)", review.Name, review.Year),
+				Kind:  "Review",
+			},
+			HTML: string(review.Review),
+		})
+	}
+
+	return sources, nil
+}
+
+func buildSearchIndex(sources []searchSource) searchIndex {
+	index := searchIndex{Terms: make(map[string][]int)}
+	for i, source := range sources {
+		// Count terms per section
+		type key struct {
+			term    string
+			section int
+		}
+		counts := make(map[key]int)
+		for _, term := range searchTerms(source.Title) {
+			counts[key{term, -1}] += searchTitleWeight
+		}
+		doc := source.searchDoc
+		forEachSectionText(source.HTML, func(anchor, header string) {
+			doc.Headers = append(doc.Headers, header)
+			doc.Anchors = append(doc.Anchors, anchor)
+		}, func(text string) {
+			for _, term := range searchTerms(text) {
+				counts[key{term, len(doc.Headers) - 1}]++
+			}
+		})
+		index.Docs = append(index.Docs, doc)
+
+		// -> Sorted, so that the index doesn't change between builds
+		var keys []key
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(a, b int) bool {
+			if keys[a].term != keys[b].term {
+				return keys[a].term < keys[b].term
+			}
+			return keys[a].section < keys[b].section
+		})
+		for _, k := range keys {
+			index.Terms[k.term] = append(index.Terms[k.term], i, k.section, counts[k])
+		}
+	}
+	return index
+}
+
+// Walks the text of some HTML, telling onHeader whenever a new (h2/h3) section
+// starts. The header's own text is given to onText after it.
+func forEachSectionText(s string, onHeader func(anchor, header string), onText func(string)) {
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0 // Inside something which isn't prose, e.g. a script
+
+	// -> The header we're in, if any
+	var inHeader bool
+	var anchor string
+	var header strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken:
+			t := z.Token()
+			switch t.Data {
+			case "script", "style":
+				skip++
+			case "h2", "h3":
+				for _, attr := range t.Attr {
+					if attr.Key == "id" {
+						inHeader = true
+						anchor = attr.Val
+						header.Reset()
+					}
+				}
+			}
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "script", "style":
+				skip--
+			case "h2", "h3":
+				if inHeader {
+					inHeader = false
+					text := strings.TrimSpace(header.String())
+					onHeader(anchor, text)
+					onText(text)
+				}
+			}
+		case html.TextToken:
+			switch {
+			case skip > 0:
+			case inHeader:
+				header.Write(z.Text())
+			default:
+				onText(string(z.Text()))
+			}
+		}
+	}
+}
+
+// Breaks text into stemmed terms, without common words.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < 2 || searchStopWords[word] {
+			continue
+		}
+		terms = append(terms, stem(word))
+	}
+	return terms
+}
+
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "so": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// A light English stemmer. It doesn't have to be right, only consistent,
+// since queries get stemmed the same way.
+func stem(word string) string {
+	w := []rune(word)
+	if len(w) <= 3 {
+		return word
+	}
+	hasSuffix := func(suffix string) bool {
+		return strings.HasSuffix(string(w), suffix)
+	}
+	trim := func(n int) {
+		w = w[:len(w)-n]
+	}
+
+	// Plurals
+	switch {
+	case hasSuffix("ies") && len(w) > 4:
+		trim(3)
+		w = append(w, 'y')
+	case hasSuffix("sses"):
+		trim(2)
+	case hasSuffix("s") && !hasSuffix("ss") && !hasSuffix("us") && !hasSuffix("is"):
+		trim(1)
+	}
+
+	// Verb and adverb endings
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed", "ly"} {
+		if !hasSuffix(suffix) || len(w)-len(suffix) < 2 {
+			continue
+		}
+		trim(len(suffix))
+		// -> e.g. running -> run
+		last := w[len(w)-1]
+		if suffix != "ly" && last == w[len(w)-2] && !strings.ContainsRune("lsz", last) {
+			trim(1)
+		}
+		break
+	}
+
+	// Loose ends, e.g. use/using, happy/happily
+	switch {
+	case hasSuffix("e") && len(w) > 2:
+		trim(1)
+	case hasSuffix("y") && len(w) > 2:
+		trim(1)
+		w = append(w, 'i')
+	}
+	return string(w)
+}
+
+func writeSearchIndex() withFile {
+	return func(w io.Writer) error {
+		sources, err := searchSources()
+		if err != nil {
+			return err
+		}
+		index := buildSearchIndex(sources)
+
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(index)
+		if err != nil {
+			log.Err(err).Msg("could not write search index")
+			return fmt.Errorf("could not write search index: %w", err)
+		}
+
+		log.Debug().
+			Int("docs", len(index.Docs)).
+			Int("terms", len(index.Terms)).
+			Msg("built search index")
+		return nil
+	}
+}
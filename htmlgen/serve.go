@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/site"
+	"github.com/rs/zerolog/log"
+)
+
+// Serve is a development server. It generates the site into a temp folder,
+// serves it (along with the static folder, layered like htmlgen build does)
+// and watches for changes. Open browsers are told to reload via server sent
+// events whenever something changes.
+//
+// What gets redone depends on what changed:
+// - Static files are served straight from their folders, but pages link to
+//   some of them by hash (see assets.go), so they and content and drafts are
+//   regenerated in-process.
+// - Go code and templates are baked in at startup, so htmlgen is rebuilt and
+//   restarted. Browsers reconnect to the new process and reload.
+
+const (
+	staticFolder        = "static"
+	staticMinableFolder = "static_minable"
+	htmlgenFolder       = "htmlgen"
+	eventsPath          = "/_htmlgen/events"
+)
+
+// Put in every HTML page served.
+const reloadScript = `<script>
+(function () {
+    var build;
+    new EventSource("` + eventsPath + `").addEventListener("build", function (e) {
+        if (build && build !== e.data) {
+            location.reload();
+        }
+        build = e.data;
+    });
+})();
+</script>`
+
+func Serve(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("htmlgen serve", flag.ContinueOnError)
+	cfg := genConfigFlags(fs)
+	addrFlag := fs.String("addr", "localhost:8080", "address to serve the site on")
+	if err := fs.Parse(args); err != nil {
+		log.Err(err).Msg("arg parse fail")
+		return err
+	}
+
+	// Build somewhere temporary
+	tmp, err := os.MkdirTemp("", "htmlgen-serve-")
+	if err != nil {
+		log.Err(err).Msg("could not make temp folder to build into")
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	cfg.OutputFolder = filepath.Join(tmp, "site")
+
+	s := &server{
+		cfg:       *cfg,
+		clients:   make(map[chan string]struct{}),
+		redirects: make(map[string]string, len(site.RedirectPages)),
+	}
+	for _, r := range site.RedirectPages {
+		s.redirects["/"+r.Short] = r.Dest
+	}
+	err = s.build()
+	if err != nil {
+		return err
+	}
+
+	// Serve until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	httpServer := &http.Server{
+		Addr:    *addrFlag,
+		Handler: s,
+	}
+	go func() {
+		<-ctx.Done()
+		s.closeClients()
+		httpServer.Close()
+	}()
+	go s.watch(ctx, stop)
+
+	log.Info().
+		Str("url", "http://"+*addrFlag).
+		Msg("serving site")
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Err(err).Str("addr", *addrFlag).Msg("server failed")
+		return err
+	}
+
+	// If a restart was asked for, then we're handing over to a new htmlgen.
+	if s.restartBin != "" {
+		os.RemoveAll(tmp)
+		return reexec(s.restartBin)
+	}
+	return nil
+}
+
+type server struct {
+	cfg        GenConfig
+	redirects  map[string]string // Keyed by path, without .html
+	restartBin string
+
+	mu      sync.Mutex // Guards the below
+	buildID string
+	clients map[chan string]struct{}
+}
+
+// ---
+// --- Serving
+// ---
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean("/" + r.URL.Path)
+	if p == eventsPath {
+		s.serveEvents(w, r)
+		return
+	}
+
+	// Redirects are done properly here
+	if dest, ok := s.redirects[strings.TrimSuffix(p, ".html")]; ok {
+		http.Redirect(w, r, dest, http.StatusMovedPermanently)
+		return
+	}
+
+	// Otherwise look for a file
+	loc, ok := s.resolve(p)
+	if !ok {
+		notFound, _ := s.resolve("/404.html")
+		s.serveFile(w, r, notFound, http.StatusNotFound)
+		return
+	}
+	s.serveFile(w, r, loc, http.StatusOK)
+}
+
+func (s *server) resolve(p string) (string, bool) {
+	return resolvePath(p, siteRoots(s.cfg.OutputFolder)...)
+}
+
+// The folders which make up the live site, layered like htmlgen build does.
+// Earlier folders take precedence, as they are copied over later ones.
+func siteRoots(outputFolder string) []string {
+	return []string{staticFolder, outputFolder}
+}
+
+// Finds the file for a URL path, trying the same things the live host would.
+func resolvePath(p string, roots ...string) (string, bool) {
+	candidates := []string{p, p + ".html", path.Join(p, "index.html")}
+	for _, candidate := range candidates {
+		for _, root := range roots {
+			loc := filepath.Join(root, filepath.FromSlash(candidate))
+			info, err := os.Stat(loc)
+			if err == nil && !info.IsDir() {
+				return loc, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (s *server) serveFile(w http.ResponseWriter, r *http.Request, loc string, status int) {
+	b, err := os.ReadFile(loc)
+	if err != nil {
+		log.Err(err).Str("loc", loc).Msg("could not read file to serve")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Pages need to be able to reload
+	if filepath.Ext(loc) == ".html" {
+		b = withReloadScript(b)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if ct := mimeType(loc); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// Only whole documents get the script: snippets are swapped into a page which
+// has it already, and each copy would listen for builds again. Pages can leave
+// out </body>, in which case it goes at the end.
+func withReloadScript(page []byte) []byte {
+	start := bytes.TrimSpace(page[:min(len(page), 64)])
+	if !bytes.HasPrefix(bytes.ToLower(start), []byte("<!doctype html")) {
+		return page
+	}
+	end := bytes.LastIndex(page, []byte("</body>"))
+	if end < 0 {
+		return append(page, reloadScript...)
+	}
+	return slices.Concat(page[:end], []byte(reloadScript), page[end:])
+}
+
+func (s *server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Subscribe
+	c := make(chan string, 1)
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	c <- s.buildID
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	// Tell the browser about every build
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case buildID, open := <-c:
+			if !open {
+				return
+			}
+			fmt.Fprintf(w, "event: build\ndata: %s\n\n", buildID)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *server) closeClients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		close(c)
+		delete(s.clients, c)
+	}
+}
+
+// Tells all open browsers to reload.
+func (s *server) built() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buildID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	for c := range s.clients {
+		// -> Drop it if they haven't picked up the last one yet, they'll reload anyway.
+		select {
+		case c <- s.buildID:
+		default:
+		}
+	}
+}
+
+func mimeType(loc string) string {
+	switch filepath.Ext(loc) {
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".css":
+		return "text/css; charset=utf-8"
+	case ".js":
+		return "text/javascript; charset=utf-8"
+	case ".xml":
+		return "application/xml"
+	case ".json":
+		return "application/json"
+	}
+	// Let net/http sniff it
+	return ""
+}
+
+// ---
+// --- Building
+// ---
+
+func (s *server) build() error {
+	start := time.Now()
+	err := GenSite(s.cfg)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("built in %v", time.Since(start))
+	s.built()
+	return nil
+}
+
+// Watches for changes until ctx is done. Calls stop if htmlgen needs to restart.
+func (s *server) watch(ctx context.Context, stop func()) {
+	prev := snapshot(s.watchFolders())
+	ticker := time.NewTicker(300 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur := snapshot(s.watchFolders())
+		changed := changedFiles(prev, cur)
+		prev = cur
+		if len(changed) == 0 {
+			continue
+		}
+		log.Info().Strs("files", changed).Msg("change detected")
+
+		switch {
+		case anyUnder(changed, htmlgenFolder):
+			// -> Only a rebuild of htmlgen will pick this up
+			bin, err := s.rebuildSelf()
+			if err != nil {
+				continue
+			}
+			s.restartBin = bin
+			stop()
+			return
+		default:
+			// -> Failures are logged, just wait for a fix
+			s.build()
+		}
+	}
+}
+
+func (s *server) watchFolders() []string {
+	folders := []string{htmlgenFolder, s.cfg.ContentFolder, staticFolder, staticMinableFolder}
+	if s.cfg.Drafts {
+		folders = append(folders, site.DraftsFolder)
+	}
+	return folders
+}
+
+func (s *server) rebuildSelf() (string, error) {
+	bin := filepath.Join(os.TempDir(), "htmlgen-serve")
+	log.Info().Msg("rebuilding htmlgen")
+	cmd := exec.Command("go", "build", "-C", htmlgenFolder, "-o", bin, ".")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		log.Err(err).Msg("could not rebuild htmlgen, waiting for a fix")
+		return "", err
+	}
+	return bin, nil
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func snapshot(folders []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, folder := range folders {
+		filepath.WalkDir(folder, func(p string, d fs.DirEntry, err error) error {
+			// -> Folders may well not exist (e.g. content), which is fine.
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			stamps[p] = fileStamp{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+			return nil
+		})
+	}
+	return stamps
+}
+
+func changedFiles(prev, cur map[string]fileStamp) []string {
+	var changed []string
+	for p, stamp := range cur {
+		if prevStamp, ok := prev[p]; !ok || prevStamp != stamp {
+			changed = append(changed, p)
+		}
+	}
+	for p := range prev {
+		if _, ok := cur[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+func anyUnder(files []string, folders ...string) bool {
+	for _, f := range files {
+		for _, folder := range folders {
+			if folder == "" {
+				continue
+			}
+			rel, err := filepath.Rel(folder, f)
+			if err == nil && !strings.HasPrefix(rel, "..") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Exec isn't available here, so the best we can do is ask for a restart.
+func reexec(bin string) error {
+	err := errors.New("htmlgen changed, please restart")
+	log.Err(err).Str("bin", bin).Msg("could not restart htmlgen")
+	return err
+}
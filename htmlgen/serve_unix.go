@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Replaces this process with bin, keeping the same args.
+func reexec(bin string) error {
+	log.Info().Str("bin", bin).Msg("restarting htmlgen")
+	err := syscall.Exec(bin, append([]string{bin}, os.Args[1:]...), os.Environ())
+	if err != nil {
+		log.Err(err).Str("bin", bin).Msg("could not restart htmlgen")
+	}
+	return err
+}
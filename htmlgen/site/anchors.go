@@ -0,0 +1,104 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Headings get ids (anchors) made from their text, e.g. "Design by contract"
+// becomes "design-by-contract". Ids must be unique within a page, so repeats
+// get a number on the end.
+
+func slug(text string) string {
+	var sb strings.Builder
+	gap := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if gap && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			gap = false
+			sb.WriteRune(r)
+		case r == '\'' || r == '’':
+			// -> e.g. don't -> dont
+		default:
+			gap = true
+		}
+	}
+	if sb.Len() == 0 {
+		return "section"
+	}
+	return sb.String()
+}
+
+// The ids used on a page so far.
+type anchors map[string]bool
+
+// Gives a slug for text which isn't used yet, and uses it.
+func (a anchors) unique(text string) string {
+	return a.claim(slug(text))
+}
+
+func (a anchors) claim(id string) string {
+	unique := id
+	for n := 2; a[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d", id, n)
+	}
+	a[unique] = true
+	return unique
+}
+
+// Gives each of the sections (and their subsections) an anchor, renaming
+// any heading ids in their content which clash.
+func assignAnchors(sections []Section, used anchors) {
+	for i := range sections {
+		s := &sections[i]
+		if header := s.Header + s.SubHeader; header != "" {
+			s.Anchor = used.unique(header)
+		}
+		s.Content = uniqueHeadingIDs(s.Content, used)
+		assignAnchors(s.Subsections, used)
+	}
+}
+
+var (
+	headingRegex = regexp.MustCompile(`(?s)<(h[1-6])([^>]*)>(.*?)</h[1-6]>`)
+	idAttrRegex  = regexp.MustCompile(`\sid="([^"]*)"`)
+	tagRegex     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Headings in rendered markdown already have ids, but only unique to that bit
+// of markdown. Headings written as HTML may have none, so get one from their
+// text, if they have any (e.g. not a row of stars).
+func uniqueHeadingIDs(content template.HTML, used anchors) template.HTML {
+	return template.HTML(headingRegex.ReplaceAllStringFunc(string(content), func(m string) string {
+		sub := headingRegex.FindStringSubmatch(m)
+		tag, attrs, inner := sub[1], sub[2], sub[3]
+		if id := idAttrRegex.FindStringSubmatch(attrs); id != nil {
+			attrs = strings.Replace(attrs, id[0], fmt.Sprintf(` id="%s"`, used.claim(id[1])), 1)
+		} else if text := html.UnescapeString(tagRegex.ReplaceAllString(inner, "")); strings.TrimSpace(text) != "" {
+			attrs = fmt.Sprintf(` id="%s"`, used.unique(text)) + attrs
+		}
+		return fmt.Sprintf(`<%s%s>%s</%s>`, tag, attrs, inner, tag)
+	}))
+}
+
+// Lets goldmark make heading ids the same way we do.
+type markdownIDs struct {
+	used anchors
+}
+
+func (ids markdownIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	return []byte(ids.used.unique(string(value)))
+}
+
+func (ids markdownIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
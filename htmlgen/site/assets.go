@@ -0,0 +1,34 @@
+package site
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// Stylesheets, scripts and the like are written with a hash of their contents
+// in their names, so browsers never keep an old one after a deploy. The build
+// works out the names before making any pages, and templates look them up
+// with asset, e.g. {{asset "/style.css"}}.
+
+var (
+	assetsMu sync.RWMutex
+	assets   map[string]string
+)
+
+// Sets the names assets are written as, by where they'd be without a hash.
+func SetAssets(names map[string]string) {
+	assetsMu.Lock()
+	defer assetsMu.Unlock()
+	assets = maps.Clone(names)
+}
+
+func asset(p string) (string, error) {
+	assetsMu.RLock()
+	defer assetsMu.RUnlock()
+	name, ok := assets[p]
+	if !ok {
+		return "", fmt.Errorf("no asset %s", p)
+	}
+	return name, nil
+}
@@ -1,7 +1,6 @@
 package site
 
 import (
-	"fmt"
 	"html/template"
 	"time"
 
@@ -12,6 +11,13 @@ type DatedPost struct {
 	Page
 	Date     time.Time
 	Unlisted bool
+	Tags     []Tag
+	Reading  ReadingStats
+	// Name of the series the post is part of, if any, and where it sits in it.
+	Series      string
+	SeriesOrder int
+	// File the post was loaded from, if it was not defined in Go.
+	Source string
 }
 
 var BlogPosts []DatedPost
@@ -31,24 +37,34 @@ func blogPost(
 	var allSections []Section
 	allSections = append(allSections, section("", opening))
 	allSections = append(allSections, sections...)
+	reading := readingStats("", allSections)
 
 	page := page(rootTmpl, short,
 		root(title, seoDesc,
 			article(title,
 				mul(
-					withHeaderContent(markdown(fmt.Sprintf(
-						"*Written %s*",
-						t.Format("2 January 2006"),
-					))),
+					withHeaderContent(postHeader(t, nil, reading, false)),
 				),
 				allSections...,
 			),
 			withCommentsFooter(short),
-			withJSONld(JSONldBlogPosting(title, heroImageURL, date)),
+			withJSONld(JSONldBlogPosting(title, heroImageURL, date, reading)),
+			withHeroImage(heroImageURL),
+			withOGArticle,
+			withOGDate(t),
 		))
 
 	return DatedPost{
-		Page: page,
-		Date: t,
+		Page:    page,
+		Date:    t,
+		Reading: reading,
 	}
 }
+
+// The hero image, if there is one, is what shows in link previews.
+func withHeroImage(file string) func(r *Root) {
+	if file == "" {
+		return nil
+	}
+	return withOGImage("/images/" + file)
+}
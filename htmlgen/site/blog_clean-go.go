@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	BlogPosts = append(BlogPosts, blogPost(
+	post := blogPost(
 		"clean-go",
 		`Notes on applying "The Clean Architecture" in Go`,
 		"This article introduces Clean Architecture in Go. It discusses the layers involved, provides guidance on code placement, and suggests package structuring.",
@@ -21,7 +21,9 @@ func init() {
 		cleanGo_jsonStruct,
 		cleanGo_entities,
 		cleanGo_conclusion,
-	))
+	)
+	post = withPostTOC(post, false)
+	BlogPosts = append(BlogPosts, tagged(post, false, "go", "architecture"))
 }
 
 const cleanGo_opening = `
@@ -284,7 +286,7 @@ protect the entity - it is the use case layer's job to deal with these errors.
 `),
 	withAsideFigure(figure("The Entity is King, and treats itself as such.", image(
 		"my-super-sweet-16.jpg",
-		375, 500,
+		500, 375,
 		"A boy dressed as a king on a throne in a super sweet 16 reality show",
 	))),
 )
@@ -13,7 +13,7 @@ func init() {
 		"Contains proverbs and advice around programming and developer life.",
 		civil.Date{Year: 2024, Month: time.February, Day: 21},
 		markdown(proverb_opening),
-		"epictetus.jpg",
+		"proverbs/epictetus.jpg",
 		superSection("Code Design", "",
 			proverb_applyingDry,
 			proverb_minimizeShit,
@@ -34,7 +34,8 @@ func init() {
 		),
 	)
 	// Its unlisted, in the nav.
-	post.Unlisted = true
+	post = tagged(post, true, "programming", "go")
+	post = withPostTOC(post, true)
 	BlogPosts = append(BlogPosts, post)
 }
 
@@ -178,7 +179,7 @@ opportunities for commenting:
 * Any function or piece of code which is working around something; e.g. a badly
   designed external API.
 * Assumptions around the form of input which cannot be expressed clearly
-  with types (though see [Design by Contract](#Design%20by%20contract)).
+  with types (though see [Design by Contract](#design-by-contract)).
 * Any code which is logically related but where the relationship 
   cannot be enforced by the code (e.g. needing a struct definition to stay in
   sync between a client and repository package).
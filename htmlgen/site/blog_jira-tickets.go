@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	BlogPosts = append(BlogPosts, blogPost(
+	post := blogPost(
 		"jira-tickets",
 		"How I use JIRA tickets",
 		"This article speaks to how I use JIRA tickets or kanban cards: as a blueprint, as a second brain, and as a form of asynchronous communication.",
@@ -18,7 +18,8 @@ func init() {
 		jira_ticketsAsASecondBrain,
 		jira_ticketsAsAsync,
 		jira_conclusion,
-	))
+	)
+	BlogPosts = append(BlogPosts, tagged(post, false, "productivity", "workflow"))
 }
 
 const jira_opening = `
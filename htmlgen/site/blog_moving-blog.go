@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	BlogPosts = append(BlogPosts, blogPost(
+	post := blogPost(
 		"moving-blog",
 		`My journey to create a static site generator`,
 		"Recounts my reasoning and experiences in moving away from Jekyll towards my own Go based static site generator",
@@ -19,7 +19,8 @@ func init() {
 		moving_firstStab,
 		moving_widgetDSL,
 		moving_conclusion,
-	))
+	)
+	BlogPosts = append(BlogPosts, tagged(post, false, "go", "web"))
 }
 
 const moving_opening = `
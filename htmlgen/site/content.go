@@ -0,0 +1,381 @@
+package site
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/civil"
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Blog posts can also be written as markdown files with front matter, so that
+// new posts don't need a recompile. These are loaded at generation time, and
+// end up as the same DatedPost values as the Go defined ones.
+//
+// A content file looks something like this:
+//
+//	---
+//	short: some-short-url
+//	title: Some title
+//	seo_description: Some meta SEO description
+//	date: 2024-02-20
+//	hero_image: some-image.jpg
+//	tags: [go, architecture]
+//	series: Some series
+//	series_order: 1
+//	toc: true
+//	toc_sidebar: true
+//	sections:
+//	  - header: Some section
+//	    figures:
+//	      - caption: Some caption
+//	        images:
+//	          - file: some-image.jpg
+//	            width: 512
+//	            height: 512
+//	            alt: Some alt text
+//	---
+//	The opening, in markdown.
+//
+//	## Some section
+//	More markdown.
+//
+// YAML front matter is fenced by "---", and TOML front matter by "+++".
+// Each "## " heading in the body starts a new section. Sections marked as
+// "super" in the front matter have their "### " headings folded in as
+// subsections.
+
+type frontMatter struct {
+	Short          string               `yaml:"short" toml:"short"`
+	Title          string               `yaml:"title" toml:"title"`
+	SEODescription string               `yaml:"seo_description" toml:"seo_description"`
+	Date           contentDate          `yaml:"date" toml:"date"`
+	HeroImage      string               `yaml:"hero_image" toml:"hero_image"`
+	Unlisted       bool                 `yaml:"unlisted" toml:"unlisted"`
+	Tags           []string             `yaml:"tags" toml:"tags"`
+	Series         string               `yaml:"series" toml:"series"`
+	SeriesOrder    int                  `yaml:"series_order" toml:"series_order"`
+	TOC            bool                 `yaml:"toc" toml:"toc"`
+	TOCSidebar     bool                 `yaml:"toc_sidebar" toml:"toc_sidebar"`
+	Sections       []frontMatterSection `yaml:"sections" toml:"sections"`
+}
+
+// Dates come through as plain text from YAML, but as timestamps from TOML.
+type contentDate civil.Date
+
+func (d *contentDate) UnmarshalText(b []byte) error {
+	s, _, _ := strings.Cut(string(b), "T")
+	date, err := civil.ParseDate(s)
+	if err != nil {
+		return fmt.Errorf("date must be of the form YYYY-MM-DD: %w", err)
+	}
+	*d = contentDate(date)
+	return nil
+}
+
+type frontMatterSection struct {
+	Header  string              `yaml:"header" toml:"header"`
+	Super   bool                `yaml:"super" toml:"super"`
+	Figures []frontMatterFigure `yaml:"figures" toml:"figures"`
+}
+
+type frontMatterFigure struct {
+	Caption  string             `yaml:"caption" toml:"caption"`
+	Optional bool               `yaml:"optional" toml:"optional"`
+	Images   []frontMatterImage `yaml:"images" toml:"images"`
+}
+
+type frontMatterImage struct {
+	File   string `yaml:"file" toml:"file"`
+	Width  int    `yaml:"width" toml:"width"`
+	Height int    `yaml:"height" toml:"height"`
+	Alt    string `yaml:"alt" toml:"alt"`
+}
+
+// Reads all the markdown files in folder as blog posts, and adds them to
+// BlogPosts. Posts loaded by a previous call are replaced. A missing folder
+// just means there are no such posts.
+func LoadBlogContent(folder string) error {
+	// Forget what we loaded last time
+	var blogPosts []DatedPost
+	for _, post := range BlogPosts {
+		if post.Source != "" {
+			continue
+		}
+		blogPosts = append(blogPosts, post)
+	}
+	BlogPosts = blogPosts
+
+	// What files are there
+	entries, err := os.ReadDir(folder)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		log.Err(err).
+			Str("dir", folder).
+			Msg("could not read content folder")
+		return err
+	}
+
+	// Load each one
+	shorts := make(map[string]struct{}, len(BlogPosts))
+	for _, post := range BlogPosts {
+		shorts[post.Short] = struct{}{}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+			continue
+		}
+		loc := filepath.Join(folder, entry.Name())
+
+		post, err := loadBlogPostFile(loc)
+		if err != nil {
+			log.Err(err).
+				Str("file", loc).
+				Msg("could not load blog post")
+			return fmt.Errorf("could not load blog post %s: %w", loc, err)
+		}
+
+		// -> Shorts are URLs, so they must be unique
+		if _, exists := shorts[post.Short]; exists {
+			err = fmt.Errorf("blog post short %q is already in use", post.Short)
+			log.Err(err).
+				Str("file", loc).
+				Msg("could not load blog post")
+			return err
+		}
+		shorts[post.Short] = struct{}{}
+
+		BlogPosts = append(BlogPosts, post)
+		log.Debug().Str("file", loc).Msg("loaded blog post")
+	}
+
+	return nil
+}
+
+func loadBlogPostFile(loc string) (DatedPost, error) {
+	b, err := os.ReadFile(loc)
+	if err != nil {
+		return DatedPost{}, err
+	}
+
+	fm, body, err := parseFrontMatter(b)
+	if err != nil {
+		return DatedPost{}, err
+	}
+
+	// Fill in the gaps
+	if fm.Short == "" {
+		fm.Short = strings.TrimSuffix(filepath.Base(loc), ".md")
+	}
+
+	return contentBlogPost(fm, body, loc)
+}
+
+func contentBlogPost(fm frontMatter, body string, loc string) (DatedPost, error) {
+	if fm.Title == "" {
+		return DatedPost{}, errors.New("title is required")
+	}
+	date := civil.Date(fm.Date)
+	if !date.IsValid() {
+		return DatedPost{}, errors.New("date is required")
+	}
+
+	// Split the body into sections
+	opening, sections, err := contentSections(body, fm.Sections)
+	if err != nil {
+		return DatedPost{}, err
+	}
+
+	post := blogPost(
+		fm.Short,
+		fm.Title,
+		fm.SEODescription,
+		date,
+		markdown(opening),
+		fm.HeroImage,
+		sections...,
+	)
+	post.Unlisted = fm.Unlisted
+	if len(fm.Tags) > 0 {
+		post = tagged(post, fm.Unlisted, fm.Tags...)
+	}
+	if fm.Series != "" {
+		post = inSeries(post, fm.Series, fm.SeriesOrder)
+	}
+	if fm.TOC || fm.TOCSidebar {
+		post = withPostTOC(post, fm.TOCSidebar)
+	}
+	post.Source = loc
+	return post, nil
+}
+
+// Separates the front matter from the markdown body.
+func parseFrontMatter(b []byte) (frontMatter, string, error) {
+	var fm frontMatter
+	s := normaliseNewlines(b)
+
+	// Which kind is it?
+	var fence string
+	var unmarshal func([]byte, any) error
+	switch {
+	case strings.HasPrefix(s, "---\n"):
+		fence = "---"
+		unmarshal = yaml.Unmarshal
+	case strings.HasPrefix(s, "+++\n"):
+		fence = "+++"
+		unmarshal = toml.Unmarshal
+	default:
+		return fm, "", errors.New("file must start with front matter (--- for YAML, +++ for TOML)")
+	}
+
+	// Find the closing fence
+	rest := s[len(fence)+1:]
+	var raw string
+	if strings.HasPrefix(rest, fence+"\n") {
+		rest = rest[len(fence)+1:]
+	} else {
+		var found bool
+		raw, rest, found = strings.Cut(rest, "\n"+fence+"\n")
+		if !found {
+			return fm, "", fmt.Errorf("front matter is not closed by %s", fence)
+		}
+	}
+
+	// And decode
+	err := unmarshal([]byte(raw), &fm)
+	if err != nil {
+		return fm, "", fmt.Errorf("invalid front matter: %w", err)
+	}
+	return fm, rest, nil
+}
+
+// Splits the body by "## " headings. Anything before the first heading is the
+// opening.
+func contentSections(body string, meta []frontMatterSection) (string, []Section, error) {
+	metaByHeader := make(map[string]frontMatterSection, len(meta))
+	for _, m := range meta {
+		metaByHeader[m.Header] = m
+	}
+	used := make(map[string]bool, len(meta))
+
+	opening, chunks := splitHeadings(body, "## ")
+	var sections []Section
+	for _, chunk := range chunks {
+		m := metaByHeader[chunk.header]
+		used[chunk.header] = true
+
+		// Plain section
+		if !m.Super {
+			s, err := contentSection(chunk.header, chunk.content, m)
+			if err != nil {
+				return "", nil, err
+			}
+			sections = append(sections, s)
+			continue
+		}
+
+		// Super section, so look for subsections
+		lead, subChunks := splitHeadings(chunk.content, "### ")
+		var subSections []Section
+		for _, subChunk := range subChunks {
+			used[subChunk.header] = true
+			s, err := contentSection(subChunk.header, subChunk.content, metaByHeader[subChunk.header])
+			if err != nil {
+				return "", nil, err
+			}
+			subSections = append(subSections, s)
+		}
+		sections = append(sections, superSection(chunk.header, markdownOrEmpty(lead), subSections...))
+	}
+
+	// Front matter should not refer to sections which aren't there
+	for _, m := range meta {
+		if !used[m.Header] {
+			return "", nil, fmt.Errorf("front matter refers to section %q, but there is no such heading", m.Header)
+		}
+	}
+
+	return opening, sections, nil
+}
+
+func contentSection(header string, content string, m frontMatterSection) (Section, error) {
+	var opts []func(*Section)
+	for _, fmFigure := range m.Figures {
+		var images []Image
+		for _, fmImage := range fmFigure.Images {
+			if fmImage.File == "" || fmImage.Width <= 0 || fmImage.Height <= 0 {
+				return Section{}, fmt.Errorf("image in section %q needs a file, width and height", header)
+			}
+			images = append(images, image(fmImage.File, fmImage.Width, fmImage.Height, fmImage.Alt))
+		}
+
+		f := figure(fmFigure.Caption, images...)
+		if fmFigure.Optional {
+			f = optionalFigure(fmFigure.Caption, images...)
+		}
+		opts = append(opts, withAsideFigure(f))
+	}
+
+	return section(header, markdown(content), opts...), nil
+}
+
+type headingChunk struct {
+	header  string
+	content string
+}
+
+// Splits s on lines starting with prefix, ignoring any in fenced code blocks.
+func splitHeadings(s string, prefix string) (string, []headingChunk) {
+	var lead bytes.Buffer
+	var chunks []headingChunk
+	current := &lead
+	var currentChunk bytes.Buffer
+	inFence := false
+
+	flush := func() {
+		if len(chunks) > 0 {
+			chunks[len(chunks)-1].content = currentChunk.String()
+		}
+		currentChunk.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(s, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "~~~") || strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+
+		if !inFence && strings.HasPrefix(line, prefix) {
+			flush()
+			chunks = append(chunks, headingChunk{
+				header: strings.TrimSpace(strings.TrimPrefix(line, prefix)),
+			})
+			current = &currentChunk
+			continue
+		}
+		current.WriteString(line)
+	}
+	flush()
+
+	return lead.String(), chunks
+}
+
+func normaliseNewlines(b []byte) string {
+	return strings.ReplaceAll(string(b), "\r\n", "\n")
+}
+
+func markdownOrEmpty(s string) template.HTML {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	return markdown(s)
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	DigitalRestorations = append(DigitalRestorations, digitalRestoration(
+	post := digitalRestoration(
 		"2001-restoration",
 		"2001: A Space Odyssey",
 		"Presents a restored version of an 2001 theatrical poster. Describes the restoration process.",
@@ -19,7 +19,8 @@ func init() {
 			"2001 poster",
 		),
 		twoThousandOne_desc,
-	))
+	)
+	DigitalRestorations = append(DigitalRestorations, tagged(post, false, "film posters"))
 }
 
 var twoThousandOne_desc = markdown(`
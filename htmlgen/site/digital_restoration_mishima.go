@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	DigitalRestorations = append(DigitalRestorations, digitalRestoration(
+	post := digitalRestoration(
 		"mishima",
 		"Mishima: A Life in Four Chapters",
 		"Presents a restored version of a Mishima theatrical poster. Describes the restoration process.",
@@ -19,7 +19,8 @@ func init() {
 			"Mishima poster",
 		),
 		mishima_desc,
-	))
+	)
+	DigitalRestorations = append(DigitalRestorations, tagged(post, false, "film posters"))
 }
 
 var mishima_desc = markdown(`
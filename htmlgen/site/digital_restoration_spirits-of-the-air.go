@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	DigitalRestorations = append(DigitalRestorations, digitalRestoration(
+	post := digitalRestoration(
 		"spirits-of-the-air",
 		"Spirits of the Air, Gremlins of the Clouds",
 		"Presents a restored version of a Spirits of the Air, Gremlins of the Clouds theatrical poster. Describes the restoration process.",
@@ -19,7 +19,8 @@ func init() {
 			"Spirits of the Air, Gremlins of the Clouds poster",
 		),
 		spirits_of_the_air_desc,
-	))
+	)
+	DigitalRestorations = append(DigitalRestorations, tagged(post, false, "film posters"))
 }
 
 var spirits_of_the_air_desc = markdown(`
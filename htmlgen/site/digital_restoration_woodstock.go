@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	DigitalRestorations = append(DigitalRestorations, digitalRestoration(
+	post := digitalRestoration(
 		"woodstock-restoration",
 		"Woodstock: 3 Days of Peace and Music",
 		"Presents a restored version of an old Woodstock festival poster. Describes the restoration process.",
@@ -19,7 +19,8 @@ func init() {
 			"Woodstock poster",
 		),
 		woodstock_desc,
-	))
+	)
+	DigitalRestorations = append(DigitalRestorations, tagged(post, false, "music posters"))
 }
 
 var woodstock_desc = markdown(`
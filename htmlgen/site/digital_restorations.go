@@ -1,7 +1,6 @@
 package site
 
 import (
-	"fmt"
 	"html/template"
 	"time"
 
@@ -19,18 +18,24 @@ func digitalRestoration(
 	description template.HTML,
 ) DatedPost {
 	t := date.In(time.Local)
+	content := restorationPage(linkImage, description)
+	reading := readingStats(content, nil)
 	page := page(rootTmpl, short,
 		root(title, seoDesc,
 			article(title, mul(
-				withHeaderContent(markdown(fmt.Sprintf("*Written %s*", t.Format("2 January 2006")))),
-				withRawContent(restorationPage(linkImage, description)),
+				withHeaderContent(postHeader(t, nil, reading, false)),
+				withRawContent(content),
 			)),
 			withCommentsFooter(short),
-			withJSONld(JSONldBlogPosting(title, string(linkImage.Link), date)),
+			withJSONld(JSONldBlogPosting(title, string(linkImage.Link), date, reading)),
+			withOGImage(linkImage.Image.Src),
+			withOGArticle,
+			withOGDate(t),
 		))
 	return DatedPost{
-		Page: page,
-		Date: t,
+		Page:    page,
+		Date:    t,
+		Reading: reading,
 	}
 }
 
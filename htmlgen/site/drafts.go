@@ -0,0 +1,153 @@
+package site
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/civil"
+	"github.com/rs/zerolog/log"
+)
+
+// Drafts are markdown files which aren't ready to be published yet. They get
+// rendered like any other blog post, but under /drafts/, hidden from search
+// engines and left out of any listings. This lets me review them in the real
+// layout.
+//
+// Drafts are named like 2024-02-12-some-short.md. Front matter is optional:
+// without it, the title is taken from the first "# " heading.
+
+const DraftsFolder = "_drafts"
+
+var draftFileRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)\.md$`)
+
+func LoadDrafts(folder string) ([]DatedPost, error) {
+	// What files are there
+	entries, err := os.ReadDir(folder)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Err(err).
+			Str("dir", folder).
+			Msg("could not read drafts folder")
+		return nil, err
+	}
+
+	// Load each one
+	var drafts []DatedPost
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+			continue
+		}
+		loc := filepath.Join(folder, entry.Name())
+
+		draft, err := loadDraftFile(loc)
+		if err != nil {
+			log.Err(err).
+				Str("file", loc).
+				Msg("could not load draft")
+			return nil, fmt.Errorf("could not load draft %s: %w", loc, err)
+		}
+
+		drafts = append(drafts, draft)
+		log.Debug().Str("file", loc).Msg("loaded draft")
+	}
+
+	// Latest first
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].Date.After(drafts[j].Date)
+	})
+
+	return drafts, nil
+}
+
+func loadDraftFile(loc string) (DatedPost, error) {
+	b, err := os.ReadFile(loc)
+	if err != nil {
+		return DatedPost{}, err
+	}
+
+	// Front matter is optional for drafts
+	var fm frontMatter
+	body := normaliseNewlines(b)
+	if strings.HasPrefix(body, "---\n") || strings.HasPrefix(body, "+++\n") {
+		fm, body, err = parseFrontMatter(b)
+		if err != nil {
+			return DatedPost{}, err
+		}
+	}
+
+	// Fill in the gaps from the file name
+	elem := draftFileRegex.FindStringSubmatch(filepath.Base(loc))
+	if len(elem) < 3 {
+		return DatedPost{}, errors.New("draft file name must be of the form YYYY-MM-DD-short.md")
+	}
+	if fm.Short == "" {
+		fm.Short = elem[2]
+	}
+	if !civil.Date(fm.Date).IsValid() {
+		err = fm.Date.UnmarshalText([]byte(elem[1]))
+		if err != nil {
+			return DatedPost{}, err
+		}
+	}
+	// -> And the title from the heading
+	if fm.Title == "" {
+		fm.Title, body = cutTitleHeading(body)
+	}
+	if fm.Title == "" {
+		fm.Title = fm.Short
+	}
+	if fm.SEODescription == "" {
+		fm.SEODescription = "Draft: " + fm.Title
+	}
+
+	// -> Made under /drafts/ from the start, so its URL and card are there too
+	fm.Short = "drafts/" + fm.Short
+	// -> Not on any tag page, so its tags mustn't link to them
+	fm.Unlisted = true
+	draft, err := contentBlogPost(fm, body, loc)
+	if err != nil {
+		return DatedPost{}, err
+	}
+
+	// Drafts are not for public consumption
+	draft.Data.NoIndex = true
+	draft.Data.JSONld = ""
+	draft.Data.Footer.Comments = nil
+	return draft, nil
+}
+
+// Removes the first "# " heading from s, returning its text.
+func cutTitleHeading(s string) (string, string) {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "# ") {
+			continue
+		}
+		title := strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		rest := strings.Join(append(lines[:i:i], lines[i+1:]...), "")
+		return title, rest
+	}
+	return "", s
+}
+
+// A listing of all the drafts, so they can be found easily.
+func DraftsIndexPage(drafts []DatedPost) Page {
+	return page(rootTmpl, "drafts/index", root(
+		"Drafts",
+		"Unpublished drafts.",
+		article("Drafts", mul(withRawContent(draftsTOC(drafts)))),
+		withNoIndex,
+	))
+}
+
+func draftsTOC(drafts []DatedPost) template.HTML {
+	return execTemplate(rootTmpl, "drafts-toc", drafts)
+}
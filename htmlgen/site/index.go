@@ -5,20 +5,25 @@ import (
 	"sort"
 )
 
-func IndexPage() Page {
+func IndexPage() (Page, error) {
+	toc, err := indexTOC()
+	if err != nil {
+		return Page{}, err
+	}
 	return page(rootTmpl, "index", root(
 		"Liam Pulles",
 		"Homepage for Liam Pulles's blog.",
-		article("Welcome!", mul(withRawContent(indexTOC()))),
-	))
+		article("Welcome!", mul(withRawContent(toc))),
+	)), nil
 }
 
 type IndexTOC struct {
 	BlogPosts           []DatedPost
 	DigitalRestorations []DatedPost
+	Tags                []TagCloudEntry
 }
 
-func indexTOC() template.HTML {
+func indexTOC() (template.HTML, error) {
 	// Only keep listed items
 	var blogPosts []DatedPost
 	for _, post := range BlogPosts {
@@ -43,9 +48,15 @@ func indexTOC() template.HTML {
 		return digRestores[i].Date.After(digRestores[j].Date)
 	})
 
+	tags, err := tagCloud()
+	if err != nil {
+		return "", err
+	}
+
 	data := IndexTOC{
 		BlogPosts:           blogPosts,
 		DigitalRestorations: digRestores,
+		Tags:                tags,
 	}
-	return execTemplate(rootTmpl, "index-toc", data)
+	return execTemplate(rootTmpl, "index-toc", data), nil
 }
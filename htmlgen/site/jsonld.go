@@ -15,6 +15,7 @@ func JSONldBlogPosting(
 	title string,
 	image string,
 	datePublished civil.Date,
+	reading ReadingStats,
 ) JSONld {
 	// Pretend we wrote it at noon in SA
 	timePublished := datePublished.
@@ -26,6 +27,8 @@ func JSONldBlogPosting(
 		"headline":      title,
 		"image":         []string{fmt.Sprintf("%s/images/%s", LiveURL, image)},
 		"datePublished": timePublished,
+		"wordCount":     reading.Words,
+		"timeRequired":  fmt.Sprintf("PT%dM", reading.Minutes),
 		"author": []map[string]any{
 			{
 				"@type":    "Person",
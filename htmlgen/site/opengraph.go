@@ -0,0 +1,79 @@
+package site
+
+import (
+	"strings"
+	"time"
+)
+
+// Pages carry Open Graph (and Twitter card) metadata, so that links shared on
+// other sites show up with a title, description and image. Pages without an
+// image of their own get a generated card.
+
+// Used when a page has no image, and can't have a card made for it.
+const defaultOGImage = "/images/profile.jpg"
+
+// Where generated cards go, on the site.
+const ogCardFolder = "/images/og/"
+
+type OpenGraph struct {
+	Type        string // e.g. website, article
+	Image       string // Path on the site, e.g. /images/some-image.jpg
+	URL         string // Set by page
+	TwitterCard string
+	Card        OGCard
+}
+
+// What goes on a generated card.
+type OGCard struct {
+	Title string
+	Date  time.Time // Left off if zero
+}
+
+func defaultOpenGraph(title string) OpenGraph {
+	return OpenGraph{
+		Type: "website",
+		Card: OGCard{Title: title},
+	}
+}
+
+func (og OpenGraph) ImageURL() string {
+	return LiveURL + og.Image
+}
+
+// Whether the image is a card which the build must make.
+func (og OpenGraph) CardGenerated() bool {
+	return strings.HasPrefix(og.Image, ogCardFolder)
+}
+
+func ogCardSrc(short string) string {
+	return ogCardFolder + short + ".png"
+}
+
+// Pages without an image get a card.
+func ogWithCardFallback(og OpenGraph, short string) OpenGraph {
+	if og.Image != "" {
+		return og
+	}
+	og.Image = ogCardSrc(short)
+	og.TwitterCard = "summary_large_image"
+	return og
+}
+
+// Shows the image large, as it is specific to the page.
+func withOGImage(src string) func(r *Root) {
+	return func(r *Root) {
+		r.OpenGraph.Image = src
+		r.OpenGraph.TwitterCard = "summary_large_image"
+	}
+}
+
+func withOGArticle(r *Root) {
+	r.OpenGraph.Type = "article"
+}
+
+// Puts the date on the page's card, if it gets one.
+func withOGDate(t time.Time) func(r *Root) {
+	return func(r *Root) {
+		r.OpenGraph.Card.Date = t
+	}
+}
@@ -0,0 +1,59 @@
+package site
+
+import (
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// How long a post takes to read, going by its words.
+
+// A typical adult reading speed, for prose on a screen.
+const wordsPerMinute = 230
+
+type ReadingStats struct {
+	Words   int
+	Minutes int
+}
+
+// Counts the words in what the article would render as.
+func readingStats(rawContent template.HTML, sections []Section) ReadingStats {
+	var sb strings.Builder
+	sb.WriteString(string(rawContent))
+	for _, s := range sections {
+		sb.WriteString(string(execTemplate(rootTmpl, "section", s)))
+	}
+
+	words := countWords(sb.String())
+	return ReadingStats{
+		Words:   words,
+		Minutes: max(1, (words+wordsPerMinute-1)/wordsPerMinute),
+	}
+}
+
+func countWords(s string) int {
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0 // Inside something which isn't read as prose, e.g. a script or code
+	words := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return words
+		case html.StartTagToken:
+			switch z.Token().Data {
+			case "script", "style", "pre", "code":
+				skip++
+			}
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "script", "style", "pre", "code":
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				words += len(strings.Fields(string(z.Text())))
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package site
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/images"
+	"github.com/liampulles/liampulles.github.io/htmlgen/repo"
+	"github.com/rs/zerolog/log"
+)
+
+// Images are offered in several widths (see the images package), so browsers
+// can fetch the smallest that will look right. The build makes the widths for
+// every image the site uses, and checks they are declared the right shape.
+
+// How review posters are shown, in the reviews template.
+const (
+	PosterWidth  = 230
+	PosterHeight = 345
+)
+
+type UsedImage struct {
+	Src           string
+	Width, Height int // As declared
+}
+
+var (
+	usedImagesMu sync.Mutex
+	usedImages   = make(map[UsedImage]bool)
+)
+
+// Images used on the site so far, including drafts if they've been loaded.
+func UsedImages() []UsedImage {
+	usedImagesMu.Lock()
+	defer usedImagesMu.Unlock()
+
+	var used []UsedImage
+	for u := range usedImages {
+		used = append(used, u)
+	}
+	sort.Slice(used, func(i, j int) bool {
+		if used[i].Src != used[j].Src {
+			return used[i].Src < used[j].Src
+		}
+		return used[i].Width < used[j].Width
+	})
+	return used
+}
+
+// Gives the widths of src shown at width, and records that the site uses it.
+// Images which can't be read get none; the build reports them.
+func responsive(src string, width, height int) []images.Variant {
+	usedImagesMu.Lock()
+	usedImages[UsedImage{Src: src, Width: width, Height: height}] = true
+	usedImagesMu.Unlock()
+
+	return variants(src, width)
+}
+
+// Posters aren't recorded, as the build makes every one of them anyway.
+func posterVariants(src string) []images.Variant {
+	return variants(src, PosterWidth)
+}
+
+// For browsers which don't do srcset. It's the largest width, rather than the
+// original, as widths are fingerprinted (see assets.go).
+func sizedSrc(variants []images.Variant) string {
+	if len(variants) == 0 {
+		return ""
+	}
+	return variants[len(variants)-1].Src
+}
+
+// Shown behind a lazy poster until it loads, so the box isn't empty. Working
+// them out means decoding every poster, so they're cached. Pages can't have
+// inline styles (see csp.go), so each is a class in a stylesheet of their own,
+// named by the hash of the poster.
+func posterPlaceholder(src string) (class string, css template.CSS) {
+	hash, err := images.Hash(src)
+	if err != nil {
+		return "", ""
+	}
+
+	placeholder, ok := repo.GetImagePlaceholder(hash)
+	if !ok {
+		made, err := images.MakePlaceholder(src)
+		if err != nil {
+			log.Err(err).Str("src", src).Msg("could not make placeholder")
+			return "", ""
+		}
+		placeholder = repo.ImagePlaceholder{
+			Colour: made.Colour,
+			Bands:  made.Bands,
+		}
+		repo.UpsertImagePlaceholder(hash, placeholder)
+	}
+
+	// -> The colour shows if gradients aren't supported
+	return "placeholder-" + hash[:images.FingerprintLength], template.CSS(fmt.Sprintf(
+		"background:%s linear-gradient(%s)",
+		placeholder.Colour,
+		strings.Join(placeholder.Bands, ","),
+	))
+}
+
+func variants(src string, width int) []images.Variant {
+	realWidth, _, err := images.Size(src)
+	if err != nil {
+		return nil
+	}
+	hash, err := images.Hash(src)
+	if err != nil {
+		return nil
+	}
+	return images.Variants(src, hash, realWidth, width)
+}
+
+// Displayed at width, but never wider than the screen.
+func imageSizes(width int) string {
+	return fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", width, width)
+}
@@ -1,22 +1,51 @@
 package site
 
 import (
+	"fmt"
 	"html/template"
+	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/liampulles/liampulles.github.io/htmlgen/images"
 	"github.com/liampulles/liampulles.github.io/htmlgen/letterboxd"
 )
 
+const ReviewsShort = "reviews"
+
 func ReviewsPage() Page {
-	return page(rootTmpl, "reviews", root(
+	return page(rootTmpl, ReviewsShort, root(
 		"Reviews",
 		"Large compilation of film reviews written by me, Liam Pulles.",
 		article("Film Reviews", mul(withRawContent(reviewsPageContent()))),
+		withFeeds(reviewsFeeds...),
+		withStylesheets(PlaceholdersStylesheet),
+		withLatestPoster,
 	))
 }
 
+// Shows off the poster of the latest review, if there is one. The page is
+// only made when the export changes, so it can't have a card made for it.
+func withLatestPoster(r *Root) {
+	reviews, err := Reviews()
+	if err != nil {
+		panic(err)
+	}
+	if len(reviews) == 0 || reviews[0].PosterHref == "" {
+		r.OpenGraph.Image = defaultOGImage
+		r.OpenGraph.TwitterCard = "summary"
+		return
+	}
+	withOGImage(reviews[0].PosterHref)(r)
+}
+
+var reviewsFeeds = []FeedLink{
+	{Href: "/reviews.xml", Type: "application/atom+xml", Title: "Liam Pulles's film reviews"},
+	{Href: "/reviews.json", Type: "application/feed+json", Title: "Liam Pulles's film reviews"},
+}
+
 type ReviewsPageContent struct {
 	Years []ReviewYear
 }
@@ -27,20 +56,56 @@ type ReviewYear struct {
 }
 
 type Review struct {
-	Stars         template.HTML
-	Name          string
-	Year          int
-	DateReviewed  time.Time
-	Review        template.HTML
-	LetterboxdURI string
-	PosterHref    string
+	Stars          template.HTML
+	StarsText      string
+	Rating         int // Out of 10, like letterboxd.Review
+	Name           string
+	Year           int
+	DateReviewed   time.Time
+	Review         template.HTML
+	LetterboxdURI  string
+	PosterHref     string
+	PosterSizedSrc string // What is shown, if srcset isn't supported
+	PosterSrcset   string
+	PosterClass    string       // Gives the placeholder, while the poster loads
+	Placeholder    template.CSS // See PlaceholdersCSS
+	Anchor         string       // Element id on the reviews page
 }
 
-func reviewsPageContent() template.HTML {
+var reviewsCache struct {
+	sync.Mutex
+	fingerprint string // Of the export the reviews are from
+	reviews     []Review
+}
+
+// Reviews to show on the site, latest first. The letterboxd export is only
+// read again if it has changed (e.g. while serving), so the reviews always
+// match letterboxd.ExportFingerprint.
+func Reviews() ([]Review, error) {
+	fingerprint, err := letterboxd.ExportFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	reviewsCache.Lock()
+	defer reviewsCache.Unlock()
+	if reviewsCache.fingerprint == fingerprint {
+		return reviewsCache.reviews, nil
+	}
+	reviews, err := readReviews()
+	if err != nil {
+		return nil, err
+	}
+	reviewsCache.fingerprint = fingerprint
+	reviewsCache.reviews = reviews
+	return reviews, nil
+}
+
+func readReviews() ([]Review, error) {
 	// Read letterboxd data
 	export, err := letterboxd.ReadExport()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Sort reviews by date, latest first
@@ -52,18 +117,9 @@ func reviewsPageContent() template.HTML {
 		return export.Reviews[i].Date.After(export.Reviews[j].Date)
 	})
 
-	// Map to data format
-	var data ReviewsPageContent
-	var currentReviewYear ReviewYear
+	// Map to our format
+	var reviews []Review
 	for _, review := range export.Reviews {
-		// -> New year
-		if review.Date.Year != currentReviewYear.Year {
-			if len(currentReviewYear.Reviews) > 0 {
-				data.Years = append(data.Years, currentReviewYear)
-			}
-			currentReviewYear = ReviewYear{Year: review.Date.Year}
-		}
-
 		// Skip?
 		if shouldSkipReview(review) {
 			continue
@@ -72,23 +128,85 @@ func reviewsPageContent() template.HTML {
 		// Fix review text
 		reviewText := preFixReviewText(review.Review)
 
-		// -> Add this review to this year
-		r := Review{
-			Stars:         starRating(review.Rating),
-			Name:          review.Name,
-			Year:          review.Year,
-			DateReviewed:  review.Date.In(time.UTC),
-			Review:        markdown(reviewText),
-			LetterboxdURI: review.LetterboxdURI,
-			PosterHref:    review.PosterHref,
+		posters := posterVariants(review.PosterHref)
+		placeholderClass, placeholder := posterPlaceholder(review.PosterHref)
+		reviews = append(reviews, Review{
+			Stars:          starRating(review.Rating),
+			StarsText:      starRatingText(review.Rating),
+			Rating:         review.Rating,
+			Name:           review.Name,
+			Year:           review.Year,
+			DateReviewed:   review.Date.In(time.UTC),
+			Review:         markdown(reviewText),
+			LetterboxdURI:  review.LetterboxdURI,
+			PosterHref:     review.PosterHref,
+			PosterSizedSrc: sizedSrc(posters),
+			PosterSrcset:   images.Srcset(posters),
+			PosterClass:    placeholderClass,
+			Placeholder:    placeholder,
+			Anchor:         "review-" + path.Base(review.LetterboxdURI),
+		})
+	}
+	return reviews, nil
+}
+
+func reviewsPageContent() template.HTML {
+	reviews, err := Reviews()
+	if err != nil {
+		panic(err)
+	}
+
+	// Group by year
+	var data ReviewsPageContent
+	var currentReviewYear ReviewYear
+	for _, review := range reviews {
+		// -> New year
+		if review.DateReviewed.Year() != currentReviewYear.Year {
+			if len(currentReviewYear.Reviews) > 0 {
+				data.Years = append(data.Years, currentReviewYear)
+			}
+			currentReviewYear = ReviewYear{Year: review.DateReviewed.Year()}
 		}
-		currentReviewYear.Reviews = append(currentReviewYear.Reviews, r)
+
+		// -> Add this review to this year
+		currentReviewYear.Reviews = append(currentReviewYear.Reviews, review)
+	}
+	// -> The last year
+	if len(currentReviewYear.Reviews) > 0 {
+		data.Years = append(data.Years, currentReviewYear)
 	}
 
 	// Template
 	return execTemplate(rootTmpl, "reviews", data)
 }
 
+// Asset path of the stylesheet for review poster placeholders.
+const PlaceholdersStylesheet = "/placeholders.css"
+
+// The stylesheet of every review's poster placeholder, a class each.
+func PlaceholdersCSS() ([]byte, error) {
+	reviews, err := Reviews()
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for _, review := range reviews {
+		if review.PosterClass == "" || seen[review.PosterClass] {
+			continue
+		}
+		seen[review.PosterClass] = true
+		fmt.Fprintf(&b, ".%s {%s}\n", review.PosterClass, review.Placeholder)
+	}
+	return []byte(b.String()), nil
+}
+
+// The review as it should appear in a feed: poster, rating and body.
+func ReviewFeedContent(review Review) template.HTML {
+	return execTemplate(rootTmpl, "review-feed-content", review)
+}
+
 func starRating(rating int) template.HTML {
 	// Make the stars out of 8
 	if rating > 8 {
@@ -98,13 +216,29 @@ func starRating(rating int) template.HTML {
 	fullStars := rating / 2
 	halfStar := rating%2 == 1
 
-	s := strings.Repeat(`<i class="fa-solid fa-star"></i>`, fullStars)
+	s := strings.Repeat(string(icon("star")), fullStars)
 	if halfStar {
-		s += `<i class="fa-solid fa-star-half"></i>`
+		s += string(icon("star-half"))
 	}
 	return template.HTML(s)
 }
 
+// Plain text version of starRating, for places without icons.
+func starRatingText(rating int) string {
+	if rating > 8 {
+		rating = 8
+	}
+	if rating <= 0 {
+		return "(Zero)"
+	}
+
+	s := strings.Repeat("★", rating/2)
+	if rating%2 == 1 {
+		s += "½"
+	}
+	return s
+}
+
 func shouldSkipReview(review letterboxd.Review) bool {
 	// Skip crawley film series
 	if strings.Contains(review.Review, "industrial-films-crawley-films-ranked") {
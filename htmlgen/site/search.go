@@ -0,0 +1,21 @@
+package site
+
+import "html/template"
+
+// The search page. Like the not found page, the searching is done by
+// javascript (using the index htmlgen makes), so this is just the shell.
+func SearchPage() Page {
+	target := template.HTML(`
+	<form id="searchForm" role="search" action="/search.html">
+		<input type="search" name="q" id="searchInput" aria-label="Search"
+			placeholder="Search posts, restorations and reviews..." autocomplete="off">
+	</form>
+	<noscript><p>Search needs javascript, sorry.</p></noscript>
+	<div id="searchResults"></div>`)
+
+	return page(rootTmpl, "search", root(
+		"Search",
+		"Search the blog posts, digital restorations and film reviews on liampulles.com",
+		article("Search", mul(withRawContent(target))),
+	))
+}
@@ -0,0 +1,120 @@
+package site
+
+import (
+	"sort"
+)
+
+// Posts can be linked together, in two ways:
+// - Posts in a series (e.g. multi-part reading) get a box listing every part,
+//   with links to the parts either side.
+// - Listed blog posts link to the posts written before and after them.
+//
+// Since this needs every post to be known, it is done by LinkPosts once they
+// have all been loaded.
+
+type PostLink struct {
+	Short string
+	Title string
+}
+
+func postLink(post DatedPost) *PostLink {
+	return &PostLink{
+		Short: post.Short,
+		Title: post.Data.Title,
+	}
+}
+
+type SeriesBox struct {
+	Name  string
+	Part  int // Of this post, counting from 1
+	Parts []SeriesPart
+	Prev  *PostLink
+	Next  *PostLink
+}
+
+type SeriesPart struct {
+	PostLink
+	Current bool
+}
+
+// Puts the post in a series. Parts are ordered by order, then date.
+func inSeries(post DatedPost, name string, order int) DatedPost {
+	post.Series = name
+	post.SeriesOrder = order
+	return post
+}
+
+// Fills in the series boxes and previous/next links in post footers. Must be
+// called after all posts are loaded, and again if they change.
+func LinkPosts() {
+	linkSeries(BlogPosts, DigitalRestorations)
+	linkByDate(BlogPosts)
+}
+
+func linkSeries(postLists ...[]DatedPost) {
+	// Gather the parts of each series
+	bySeries := make(map[string][]*DatedPost)
+	for _, posts := range postLists {
+		for i := range posts {
+			post := &posts[i]
+			post.Data.Footer.Series = nil
+			if post.Series != "" {
+				bySeries[post.Series] = append(bySeries[post.Series], post)
+			}
+		}
+	}
+
+	for name, parts := range bySeries {
+		sort.SliceStable(parts, func(i, j int) bool {
+			if parts[i].SeriesOrder != parts[j].SeriesOrder {
+				return parts[i].SeriesOrder < parts[j].SeriesOrder
+			}
+			return parts[i].Date.Before(parts[j].Date)
+		})
+
+		// -> Each part gets its own box, with itself marked
+		for i, post := range parts {
+			box := &SeriesBox{
+				Name: name,
+				Part: i + 1,
+			}
+			for j, part := range parts {
+				box.Parts = append(box.Parts, SeriesPart{
+					PostLink: *postLink(*part),
+					Current:  i == j,
+				})
+			}
+			if i > 0 {
+				box.Prev = postLink(*parts[i-1])
+			}
+			if i < len(parts)-1 {
+				box.Next = postLink(*parts[i+1])
+			}
+			post.Data.Footer.Series = box
+		}
+	}
+}
+
+func linkByDate(posts []DatedPost) {
+	var listed []*DatedPost
+	for i := range posts {
+		post := &posts[i]
+		post.Data.Footer.Prev = nil
+		post.Data.Footer.Next = nil
+		if !post.Unlisted {
+			listed = append(listed, post)
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		return listed[i].Date.Before(listed[j].Date)
+	})
+
+	for i, post := range listed {
+		if i > 0 {
+			post.Data.Footer.Prev = postLink(*listed[i-1])
+		}
+		if i < len(listed)-1 {
+			post.Data.Footer.Next = postLink(*listed[i+1])
+		}
+	}
+}
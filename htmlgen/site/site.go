@@ -8,9 +8,11 @@ import (
 	"time"
 
 	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/liampulles/liampulles.github.io/htmlgen/images"
 	"github.com/rs/zerolog/log"
 	"github.com/yuin/goldmark"
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/parser"
 	goldhtml "github.com/yuin/goldmark/renderer/html"
 	"go.abhg.dev/goldmark/wikilink"
 )
@@ -29,6 +31,7 @@ var allNavElem = []NavElem{
 	nameToNav("Proverbs"),
 	nameToNav("Reviews"),
 	nameToNav("Code"),
+	nameToNav("Search"),
 }
 
 var RedirectPages = []RedirectPage{
@@ -44,7 +47,12 @@ var RedirectPages = []RedirectPage{
 
 func loadTemplate(root *template.Template, file string) *template.Template {
 	if root == nil {
-		return template.Must(template.ParseFiles(filepath.Join("htmlgen", "site", file)))
+		t := template.New(file).Funcs(template.FuncMap{
+			"asset":      asset,
+			"icon":       icon,
+			"iconSprite": iconSprite,
+		})
+		return template.Must(t.ParseFiles(filepath.Join("htmlgen", "site", file)))
 	}
 	t := template.Must(root.Clone())
 	return template.Must(t.ParseFiles(filepath.Join("htmlgen", "site", file)))
@@ -80,6 +88,8 @@ func page(
 	short string,
 	data Root,
 ) Page {
+	data.OpenGraph.URL = fmt.Sprintf("%s/%s.html", LiveURL, short)
+	data.OpenGraph = ogWithCardFallback(data.OpenGraph, short)
 	return Page{
 		Template: tmpl,
 		Short:    short,
@@ -91,6 +101,10 @@ type Root struct {
 	Title          string
 	SEODescription string
 	JSONld         template.JS
+	OpenGraph      OpenGraph
+	NoIndex        bool // Keep search engines away, e.g. for drafts
+	Feeds          []FeedLink
+	Stylesheets    []string // On top of the site wide ones, by asset path
 	NavElem        []NavElem
 	Article        Article
 	Footer         Footer
@@ -105,6 +119,8 @@ func root(
 	r := Root{
 		Title:          title,
 		SEODescription: seoDesc,
+		OpenGraph:      defaultOpenGraph(title),
+		Feeds:          siteFeeds,
 		NavElem:        allNavElem,
 		Article:        article,
 		Footer: Footer{
@@ -135,16 +151,49 @@ func withCommentsFooter(short string) func(r *Root) {
 	}
 }
 
+func withNoIndex(r *Root) {
+	r.NoIndex = true
+}
+
+// Add feeds for readers to discover, on top of the site wide ones.
+func withFeeds(feeds ...FeedLink) func(r *Root) {
+	return func(r *Root) {
+		r.Feeds = append(mul(r.Feeds...), feeds...)
+	}
+}
+
+// Add stylesheets which only this page needs.
+func withStylesheets(paths ...string) func(r *Root) {
+	return func(r *Root) {
+		r.Stylesheets = append(append([]string{}, r.Stylesheets...), paths...)
+	}
+}
+
 func withJSONld(jld JSONld) func(r *Root) {
 	return func(r *Root) {
 		r.JSONld = template.JS(jld)
 	}
 }
 
+type FeedLink struct {
+	Href  string
+	Type  string
+	Title string
+}
+
+var siteFeeds = []FeedLink{
+	{Href: "/feed.xml", Type: "application/atom+xml", Title: "Liam Pulles"},
+	{Href: "/rss.xml", Type: "application/rss+xml", Title: "Liam Pulles"},
+}
+
 type Footer struct {
 	ConnectWithMe bool
 	Year          int
 	Comments      *Comments
+	Series        *SeriesBox
+	// Posts written either side of this one.
+	Prev *PostLink
+	Next *PostLink
 }
 
 type Comments struct {
@@ -161,6 +210,8 @@ type Article struct {
 	HeaderContent template.HTML
 	RawContent    template.HTML
 	Sections      []Section
+	TOC           []TOCEntry
+	TOCSidebar    bool
 }
 
 func article(
@@ -172,7 +223,6 @@ func article(
 		Header:   header,
 		Sections: sections,
 	}
-
 	for _, opt := range opts {
 		if opt == nil {
 			continue
@@ -180,6 +230,11 @@ func article(
 		opt(&a)
 	}
 
+	// -> Raw content comes first on the page, so it gets first pick of ids
+	used := anchors{}
+	a.RawContent = uniqueHeadingIDs(a.RawContent, used)
+	assignAnchors(a.Sections, used)
+
 	return a
 }
 
@@ -202,10 +257,12 @@ func mul[T any](many ...T) []T {
 type Section struct {
 	Header    string
 	SubHeader string
+	Anchor    string // Set by article
 	Aside     struct {
 		Figures []Figure
 	}
-	Content template.HTML
+	Content     template.HTML
+	Subsections []Section // Follow the content
 }
 
 func section(
@@ -237,13 +294,15 @@ func superSection(
 	content template.HTML,
 	sections ...Section,
 ) Section {
+	var subsections []Section
 	for _, section := range sections {
 		section.SubHeader = section.Header
 		section.Header = ""
-		sectionContent := execTemplate(rootTmpl, "section", section)
-		content += sectionContent
+		subsections = append(subsections, section)
 	}
-	return section(header, content)
+	s := section(header, content)
+	s.Subsections = subsections
+	return s
 }
 
 type Figure struct {
@@ -292,10 +351,13 @@ type LinkImage struct {
 }
 
 type Image struct {
-	Src    string
-	Width  string
-	Height string
-	Alt    string
+	Src      string // The original
+	SizedSrc string // What is shown, if srcset isn't supported
+	Srcset   string
+	Sizes    string
+	Width    string
+	Height   string
+	Alt      string
 }
 
 func image(
@@ -304,11 +366,16 @@ func image(
 	height int,
 	alt string,
 ) Image {
+	src := fmt.Sprintf("/images/%s", file)
+	variants := responsive(src, width, height)
 	return Image{
-		Src:    fmt.Sprintf("/images/%s", file),
-		Width:  fmt.Sprintf("%dpx", width),
-		Height: fmt.Sprintf("%dpx", height),
-		Alt:    alt,
+		Src:      src,
+		SizedSrc: sizedSrc(variants),
+		Srcset:   images.Srcset(variants),
+		Sizes:    imageSizes(width),
+		Width:    fmt.Sprintf("%dpx", width),
+		Height:   fmt.Sprintf("%dpx", height),
+		Alt:      alt,
 	}
 }
 
@@ -323,6 +390,9 @@ var md = goldmark.New(
 			),
 		),
 	),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+	),
 	goldmark.WithRendererOptions(
 		goldhtml.WithUnsafe(),
 	),
@@ -340,7 +410,8 @@ func markdown(s string) template.HTML {
 	// Replace "Hacked" backticks
 	s = strings.ReplaceAll(s, `\'`, "`")
 	var sb strings.Builder
-	err := md.Convert([]byte(s), &sb)
+	ctx := parser.NewContext(parser.WithIDs(markdownIDs{used: anchors{}}))
+	err := md.Convert([]byte(s), &sb, parser.WithContext(ctx))
 	if err != nil {
 		log.Err(err).Msgf("could not parse markdown (%s...)", head(s, 20))
 		panic(fmt.Errorf("could not parse markdown: %w", err))
@@ -31,42 +31,42 @@ I'm no expert at this - its more of a hobby really.`)),
 		<td>Did Not Finish</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star-half"></i></td>
+		<td class="stars">`+string(starRating(1))+`</td>
 		<td>=</td>
 		<td>Practically Unwatchable</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i></td>
+		<td class="stars">`+string(starRating(2))+`</td>
 		<td>=</td>
 		<td>Horrible</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i><i class="fa-solid fa-star-half"></i></td>
+		<td class="stars">`+string(starRating(3))+`</td>
 		<td>=</td>
 		<td>Bad</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i></td>
+		<td class="stars">`+string(starRating(4))+`</td>
 		<td>=</td>
 		<td>Moderately Bad</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i><i class="fa-solid fa-star-half"></i></td>
+		<td class="stars">`+string(starRating(5))+`</td>
 		<td>=</td>
 		<td>Ok</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i></td>
+		<td class="stars">`+string(starRating(6))+`</td>
 		<td>=</td>
 		<td>Good</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i><i class="fa-solid fa-star-half"></i></td>
+		<td class="stars">`+string(starRating(7))+`</td>
 		<td>=</td>
 		<td>Very Good</td>
 	</tr>
 	<tr>
-		<td class="stars"><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i><i class="fa-solid fa-star"></i></td>
+		<td class="stars">`+string(starRating(8))+`</td>
 		<td>=</td>
 		<td>Great</td>
 	</tr>
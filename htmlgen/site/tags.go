@@ -0,0 +1,179 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Posts (and restorations) can be tagged by topic. Each tag gets a page
+// listing its posts, and the index shows a cloud of them.
+
+type Tag struct {
+	Name string
+	Slug string
+}
+
+func tag(name string) Tag {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return Tag{
+		Name: name,
+		Slug: slug(name),
+	}
+}
+
+func (t Tag) Short() string {
+	return "tags/" + t.Slug
+}
+
+// Tags the post, updating its header and JSON-LD to match. Whether it is
+// unlisted is given too, as unlisted posts aren't on tag pages, so their
+// header mustn't link to them.
+func tagged(post DatedPost, unlisted bool, names ...string) DatedPost {
+	post.Unlisted = unlisted
+	var tags []Tag
+	for _, name := range names {
+		tags = append(tags, tag(name))
+	}
+	post.Tags = tags
+	post.Data.Article.HeaderContent = postHeader(post.Date, tags, post.Reading, post.Unlisted)
+	post.Data.JSONld = template.JS(jsonldWithKeywords(JSONld(post.Data.JSONld), tags))
+	return post
+}
+
+type PostHeader struct {
+	Date     time.Time
+	Tags     []Tag
+	Reading  ReadingStats
+	Unlisted bool // Tags aren't linked, as the post isn't on their pages
+}
+
+// The "Written ..." line at the top of posts.
+func postHeader(date time.Time, tags []Tag, reading ReadingStats, unlisted bool) template.HTML {
+	return execTemplate(rootTmpl, "post-header", PostHeader{
+		Date:     date,
+		Tags:     tags,
+		Reading:  reading,
+		Unlisted: unlisted,
+	})
+}
+
+func jsonldWithKeywords(jld JSONld, tags []Tag) JSONld {
+	if len(jld) == 0 || len(tags) == 0 {
+		return jld
+	}
+	var m map[string]any
+	err := json.Unmarshal(jld, &m)
+	if err != nil {
+		panic(fmt.Errorf("invalid json-ld data: %w", err))
+	}
+
+	var keywords []string
+	for _, t := range tags {
+		keywords = append(keywords, t.Name)
+	}
+	m["keywords"] = strings.Join(keywords, ", ")
+
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(fmt.Errorf("invalid json-ld data: %w", err))
+	}
+	return bytes
+}
+
+type TagListing struct {
+	Tag   Tag
+	Posts []DatedPost // Latest first
+}
+
+// Listed posts and restorations, by tag (alphabetically). Tags which come
+// out with the same slug would be on the same page, so aren't allowed.
+func tagListings() ([]TagListing, error) {
+	var all []DatedPost
+	all = append(all, BlogPosts...)
+	all = append(all, DigitalRestorations...)
+
+	byTag := make(map[Tag][]DatedPost)
+	bySlug := make(map[string]Tag)
+	for _, post := range all {
+		if post.Unlisted {
+			continue
+		}
+		for _, t := range post.Tags {
+			if other, ok := bySlug[t.Slug]; ok && other != t {
+				err := fmt.Errorf("tags %q and %q both have the slug %q", other.Name, t.Name, t.Slug)
+				log.Err(err).Str("short", post.Short).Msg("clashing tags")
+				return nil, err
+			}
+			bySlug[t.Slug] = t
+			byTag[t] = append(byTag[t], post)
+		}
+	}
+
+	var listings []TagListing
+	for t, posts := range byTag {
+		sort.SliceStable(posts, func(i, j int) bool {
+			return posts[i].Date.After(posts[j].Date)
+		})
+		listings = append(listings, TagListing{
+			Tag:   t,
+			Posts: posts,
+		})
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].Tag.Name < listings[j].Tag.Name
+	})
+	return listings, nil
+}
+
+func TagPages() ([]Page, error) {
+	listings, err := tagListings()
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []Page
+	for _, listing := range listings {
+		title := fmt.Sprintf("Posts tagged \"%s\"", listing.Tag.Name)
+		pages = append(pages, page(rootTmpl, listing.Tag.Short(), root(
+			title,
+			fmt.Sprintf("Blog posts and digital restorations by Liam Pulles, tagged \"%s\".", listing.Tag.Name),
+			article(title, mul(withRawContent(execTemplate(rootTmpl, "tag-toc", listing)))),
+		)))
+	}
+	return pages, nil
+}
+
+type TagCloudEntry struct {
+	Tag    Tag
+	Count  int
+	Weight int // 1 to 4, for sizing
+}
+
+func tagCloud() ([]TagCloudEntry, error) {
+	listings, err := tagListings()
+	if err != nil {
+		return nil, err
+	}
+
+	most := 0
+	for _, listing := range listings {
+		most = max(most, len(listing.Posts))
+	}
+
+	var cloud []TagCloudEntry
+	for _, listing := range listings {
+		count := len(listing.Posts)
+		cloud = append(cloud, TagCloudEntry{
+			Tag:    listing.Tag,
+			Count:  count,
+			Weight: 1 + (count-1)*3/max(most-1, 1),
+		})
+	}
+	return cloud, nil
+}
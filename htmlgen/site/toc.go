@@ -0,0 +1,47 @@
+package site
+
+// Long articles can have a table of contents, linking to each of their
+// sections (and the subsections folded into them). On wide screens, it can
+// instead sit in a sidebar which follows the reader down the page.
+
+type TOCEntry struct {
+	Header   string
+	Anchor   string
+	Children []TOCEntry
+}
+
+func withTOC(sidebar bool) func(a *Article) {
+	return func(a *Article) {
+		a.TOC = articleTOC(a.Sections)
+		a.TOCSidebar = sidebar
+	}
+}
+
+// Gives the post a table of contents.
+func withPostTOC(post DatedPost, sidebar bool) DatedPost {
+	withTOC(sidebar)(&post.Data.Article)
+	return post
+}
+
+func articleTOC(sections []Section) []TOCEntry {
+	var toc []TOCEntry
+	for _, s := range sections {
+		if s.Header != "" {
+			entry := TOCEntry{Header: s.Header, Anchor: s.Anchor}
+			entry.Children = articleTOC(s.Subsections)
+			toc = append(toc, entry)
+		}
+		if s.SubHeader == "" {
+			continue
+		}
+		// -> A lone subsection goes under the last section, if there is one.
+		sub := TOCEntry{Header: s.SubHeader, Anchor: s.Anchor}
+		if len(toc) == 0 {
+			toc = append(toc, sub)
+			continue
+		}
+		last := &toc[len(toc)-1]
+		last.Children = append(last.Children, sub)
+	}
+	return toc
+}
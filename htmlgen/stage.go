@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sites are built in a staging folder next to the output folder, which only
+// replaces the output folder once everything has been generated. So if a
+// build fails, the last good site is left as is.
+//
+// To keep builds incremental, the staging folder starts off as a copy of the
+// last build. The copy is made with hard links where possible, so it is cheap,
+// and files are always replaced rather than written over, so the last build
+// is never changed.
+
+const stagingSuffix = ".staging"
+
+// Makes a staging folder for outputFolder, seeded from the last build unless
+// starting fresh.
+func stageOutput(outputFolder string, fresh bool) (string, error) {
+	staging := filepath.Clean(outputFolder) + stagingSuffix
+
+	// -> A failed or interrupted build may have left one behind.
+	err := deleteFolder(staging)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(staging, os.ModePerm)
+	if err == nil && !fresh {
+		err = linkTree(outputFolder, staging)
+	}
+	if err != nil {
+		log.Err(err).
+			Str("output_folder", outputFolder).
+			Str("staging_folder", staging).
+			Msg("could not stage output folder, failing")
+		return "", err
+	}
+
+	return staging, nil
+}
+
+// Mirrors the files in src into dest.
+func linkTree(src, dest string) error {
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(to, os.ModePerm)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return linkOrCopy(p, to)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		// -> No last build, so nothing to mirror.
+		return nil
+	}
+	return err
+}
+
+func linkOrCopy(src, dest string) error {
+	err := os.Link(src, dest)
+	if err == nil {
+		return nil
+	}
+
+	// -> Hard links aren't always possible, so fall back to a copy
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return errors.Join(err, out.Close())
+}
+
+// Puts the staging folder in place of the output folder, and gets rid of
+// the last build.
+func swapOutput(staging, outputFolder string) error {
+	// -> If there is no last build, a rename will do
+	_, err := os.Stat(outputFolder)
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.Rename(staging, outputFolder)
+		if err != nil {
+			log.Err(err).
+				Str("output_folder", outputFolder).
+				Str("staging_folder", staging).
+				Msg("could not move staging folder into place, failing")
+			return err
+		}
+		return nil
+	}
+
+	// -> Otherwise swap them, and staging is left with the last build.
+	err = exchangeFolders(staging, outputFolder)
+	if err != nil {
+		log.Err(err).
+			Str("output_folder", outputFolder).
+			Str("staging_folder", staging).
+			Msg("could not swap staging folder into place, failing")
+		return err
+	}
+	return deleteFolder(staging)
+}
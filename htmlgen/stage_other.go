@@ -0,0 +1,28 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// Swaps a and b. This isn't atomic, but the output folder is only missing
+// for the moment between the renames.
+func exchangeFolders(a, b string) error {
+	tmp := b + ".old"
+	err := os.RemoveAll(tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(b, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(a, b)
+	if err != nil {
+		// -> Put the last build back
+		os.Rename(tmp, b)
+		return err
+	}
+	return os.Rename(tmp, a)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/liampulles/liampulles.github.io/htmlgen/images"
+	"github.com/rs/zerolog/log"
+)
+
+// How tall restoration thumbs are.
+const thumbHeight = 1000
+
+// Makes a smaller copy of an image, e.g. for restoration thumbs.
+//
+//	htmlgen thumb <in.png> <out.jpg>
+func Thumb(args []string) error {
+	if len(args) != 2 {
+		err := errors.New("usage: htmlgen thumb <in> <out.jpg>")
+		log.Err(err).Strs("args", args).Msg("arg parse fail")
+		return err
+	}
+	in, out := args[0], args[1]
+
+	// -> Written aside and moved in, so a failed thumb never looks up to date
+	tmp := fmt.Sprintf("%s.%d.tmp", out, os.Getpid())
+	err := writeThumb(tmp, in)
+	if err == nil {
+		err = os.Rename(tmp, out)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Err(err).Str("in", in).Str("out", out).Msg("could not make thumb")
+		return err
+	}
+	return nil
+}
+
+func writeThumb(out, in string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = images.Thumb(f, in, thumbHeight)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
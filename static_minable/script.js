@@ -54,6 +54,185 @@ function startDetailsImageLoad() {
   });
 }
 
+// --- Search ---
+// This stems words in the same way htmlgen does when it makes the index (see
+// search.go), so the two must be kept in sync.
+const searchStopWords = new Set([
+  "a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in",
+  "into", "is", "it", "no", "not", "of", "on", "or", "so", "such", "that", "the",
+  "their", "then", "there", "these", "they", "this", "to", "was", "will", "with",
+]);
+
+function stem(word) {
+  let w = Array.from(word);
+  if (w.length <= 3) return word;
+  const hasSuffix = (suffix) => w.join("").endsWith(suffix);
+  const trim = (n) => { w = w.slice(0, w.length - n); };
+
+  // Plurals
+  if (hasSuffix("ies") && w.length > 4) {
+    trim(3);
+    w.push("y");
+  } else if (hasSuffix("sses")) {
+    trim(2);
+  } else if (hasSuffix("s") && !hasSuffix("ss") && !hasSuffix("us") && !hasSuffix("is")) {
+    trim(1);
+  }
+
+  // Verb and adverb endings
+  for (const suffix of ["ingly", "edly", "ing", "ed", "ly"]) {
+    if (!hasSuffix(suffix) || w.length - suffix.length < 2) continue;
+    trim(suffix.length);
+    const last = w[w.length - 1];
+    if (suffix !== "ly" && last === w[w.length - 2] && !"lsz".includes(last)) {
+      trim(1);
+    }
+    break;
+  }
+
+  // Loose ends
+  if (hasSuffix("e") && w.length > 2) {
+    trim(1);
+  } else if (hasSuffix("y") && w.length > 2) {
+    trim(1);
+    w.push("i");
+  }
+  return w.join("");
+}
+
+function searchWords(text) {
+  return text.toLowerCase()
+    .split(/[^\p{L}\p{Nd}]+/u)
+    .filter((word) => Array.from(word).length >= 2 && !searchStopWords.has(word));
+}
+
+// Scores docs by how often the query's terms appear in them. Docs must have
+// every term. The last word may be half typed, so it matches as a prefix.
+function search(index, query) {
+  const words = searchWords(query);
+  let scores = null;
+  words.forEach((word, i) => {
+    const term = stem(word);
+    let keys = [term];
+    if (i === words.length - 1) {
+      keys = Object.keys(index.terms).filter((k) => k.startsWith(term) || k.startsWith(word));
+    }
+
+    // -> Tally up this term
+    const termScores = new Map();
+    keys.forEach((k) => {
+      if (!Object.prototype.hasOwnProperty.call(index.terms, k)) return;
+      const postings = index.terms[k];
+      for (let p = 0; p < postings.length; p += 3) {
+        const [doc, section, count] = postings.slice(p, p + 3);
+        const s = termScores.get(doc) || { score: 0, sections: new Map() };
+        s.score += count;
+        s.sections.set(section, (s.sections.get(section) || 0) + count);
+        termScores.set(doc, s);
+      }
+    });
+
+    // -> Only keep docs which had every term so far
+    if (scores === null) {
+      scores = termScores;
+      return;
+    }
+    const both = new Map();
+    scores.forEach((s, doc) => {
+      const t = termScores.get(doc);
+      if (!t) return;
+      t.sections.forEach((count, section) => {
+        s.sections.set(section, (s.sections.get(section) || 0) + count);
+      });
+      both.set(doc, { score: s.score + t.score, sections: s.sections });
+    });
+    scores = both;
+  });
+  if (scores === null) return [];
+
+  // Best first, linking to the best section where there is one
+  return Array.from(scores.entries())
+    .sort((a, b) => b[1].score - a[1].score)
+    .slice(0, 50)
+    .map(([doc, s]) => {
+      let best = -1;
+      s.sections.forEach((count, section) => {
+        if (section >= 0 && (best < 0 || count > s.sections.get(best))) best = section;
+      });
+      const d = index.docs[doc];
+      return { doc: d, header: best >= 0 ? d.h[best] : "", anchor: best >= 0 ? d.a[best] : "" };
+    });
+}
+
+function renderSearchResults(results, query, container) {
+  container.replaceChildren();
+  if (!query.trim()) return;
+  if (!results.length) {
+    const p = document.createElement("p");
+    p.textContent = "Nothing found, sorry.";
+    container.append(p);
+    return;
+  }
+
+  const ul = document.createElement("ul");
+  results.forEach((r) => {
+    const li = document.createElement("li");
+    const a = document.createElement("a");
+    a.textContent = r.doc.t;
+    if (r.doc.s) {
+      // -> Snippets open up in place
+      a.className = "snippet-link";
+      a.setAttribute("hx-get", r.doc.u);
+      a.setAttribute("hx-swap", "afterend");
+    } else {
+      a.href = r.anchor ? r.doc.u + "#" + r.anchor : r.doc.u;
+    }
+    const kind = document.createElement("i");
+    kind.textContent = " " + r.doc.k + (r.header ? ", in \"" + r.header + "\"" : "");
+    li.append(a, kind);
+    ul.append(li);
+  });
+  container.append(ul);
+  if (window.htmx) htmx.process(container);
+}
+
+const searchInput = document.getElementById("searchInput");
+if (searchInput) {
+  const searchResults = document.getElementById("searchResults");
+  const initialQuery = new URLSearchParams(window.location.search).get("q") || "";
+  searchInput.value = initialQuery;
+  document.getElementById("searchForm").addEventListener("submit", (e) => e.preventDefault());
+
+  fetch("/search_index.json")
+    .then((resp) => resp.json())
+    .then((index) => {
+      const update = () => {
+        const query = searchInput.value;
+        renderSearchResults(search(index, query), query, searchResults);
+        const url = new URL(window.location);
+        if (query) {
+          url.searchParams.set("q", query);
+        } else {
+          url.searchParams.delete("q");
+        }
+        history.replaceState(null, "", url);
+      };
+      searchInput.addEventListener("input", update);
+      update();
+    });
+  searchInput.focus();
+}
+
+// --- Close snippets ---
+// Snippets are swapped in by htmx, so listen on the document rather than
+// each button.
+document.addEventListener("click", function(e) {
+  var close = e.target.closest(".close-snippet");
+  if (close) {
+    close.closest(".snippet").remove();
+  }
+});
+
 // --- Insert maybe pages into 404 page ---
 function levenshteinDistance(s, t) {
   if (!s.length) return t.length;